@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/miekg/gitopper/gitcmd"
+	"github.com/miekg/gitopper/ospkg"
+	"github.com/miekg/gitopper/ossvc"
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// Problem is a problem found in the config.
+type Problem struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Machine string `json:"machine,omitempty"`
+	Service string `json:"service,omitempty"`
+	Message string `json:"message"`
+
+	table  string // TOML table the problem is found in, "global" or "services".
+	index  int    // index of the service in the config.
+	pos    int    // index of table in its file, for arrays of tables.
+	needle string // text close to the problem, used to find the line number.
+}
+
+func (p Problem) Error() string {
+	b := &strings.Builder{}
+	switch {
+	case p.File != "" && p.Line > 0:
+		fmt.Fprintf(b, "%s:%d: ", p.File, p.Line)
+	case p.File != "":
+		fmt.Fprintf(b, "%s: ", p.File)
+	}
+	if p.table == "services" {
+		fmt.Fprintf(b, "machine #%d %q, service %q: ", p.index, p.Machine, p.Service)
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// line returns the line number in doc p refers to. This is the line of the table header, or the first line after
+// it that contains p.needle, when found before the next table header. Zero is returned if nothing is found.
+func (p Problem) line(doc []byte) int {
+	if p.table == "" && p.needle != "" {
+		for i, l := range bytes.Split(doc, []byte("\n")) {
+			if bytes.Contains(l, []byte(p.needle)) {
+				return i + 1
+			}
+		}
+	}
+	if p.table == "" {
+		return 0
+	}
+	header := "[" + p.table + "]"
+	if p.table == "services" {
+		header = "[[" + p.table + "]]"
+	}
+	found, index := 0, -1
+	for i, l := range bytes.Split(doc, []byte("\n")) {
+		l = bytes.TrimSpace(l)
+		if bytes.HasPrefix(l, []byte("[")) {
+			if found > 0 {
+				break
+			}
+			if bytes.HasPrefix(l, []byte(header)) {
+				index++
+			}
+			if index == p.pos {
+				found = i + 1
+			}
+			continue
+		}
+		if found > 0 && p.needle != "" && bytes.Contains(l, []byte(p.needle)) {
+			return i + 1
+		}
+	}
+	return found
+}
+
+// Problems is a list of problems found in the config.
+type Problems []Problem
+
+func (p Problems) Error() string {
+	s := make([]string, len(p))
+	for i := range p {
+		s[i] = p[i].Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Check checks the config in c and returns all problems found. Only c itself is checked, see checkConfig for checks
+// on the public keys and the upstream repositories.
+func (c Config) Check() Problems { return c.problems(true) }
+
+// problems returns the problems found in c. If lint is true, problems that don't stop the daemon from running the
+// config are included as well: duplicate services, unknown actions and overlapping dirs.
+func (c Config) problems(lint bool) Problems {
+	problems := Problems{}
+	if len(c.Global.Keys) == 0 {
+		problems = append(problems, Problem{Message: "at least one public key should be specified", table: "global"})
+	}
+	global := c.Global
+	if global.Service == nil {
+		global.Service = &Service{}
+	}
+
+	type local struct {
+		path    string
+		service string
+	}
+	services := map[string]int{}   // machine/service -> index, to find duplicates
+	locals := map[string][]local{} // machine -> locals, to find overlapping dirs
+	for i, serv := range c.Services {
+		s := serv.config()
+		s.defaults(global)
+		problem := func(needle, format string, a ...interface{}) {
+			problems = append(problems, Problem{Machine: s.Machine, Service: s.Service, Message: fmt.Sprintf(format, a...), File: s.file, table: "services", index: i, pos: s.index, needle: needle})
+		}
+
+		if err := c.checkMachines(s); err != nil {
+			problem("", "%s", err)
+		}
+		if s.Upstream == "" {
+			problem("", "has empty upstream")
+		}
+		if s.Mount == "" {
+			problem("", "has empty mount")
+		}
+		if s.Service == "" {
+			problem("", "has empty service")
+		}
+		machines := c.selectors(s)
+		for _, m := range machines {
+			if !lint {
+				break
+			}
+			if j, ok := services[m+"/"+s.Service]; ok && j != i {
+				problem("", "duplicate service for machine %q, also defined in service #%d", m, j)
+				break
+			}
+			services[m+"/"+s.Service] = i
+		}
+
+		switch s.Kind {
+		case "":
+			actions := ossvc.Actions(s.Manager)
+			if actions == nil {
+				problem(fmt.Sprintf("%q", s.Manager), "unknown service manager %q", s.Manager)
+				break
+			}
+			if lint && s.Action != "" && !contains(actions, s.Action) {
+				problem(fmt.Sprintf("%q", s.Action), "unknown action %q, should be one of %v", s.Action, actions)
+			}
+		case KindCompose:
+			if len(s.Dirs) == 0 {
+				problem("", "compose needs a dir with the compose file")
+			}
+			switch s.Action {
+			case "", "up", "pull":
+			default:
+				problem(fmt.Sprintf("%q", s.Action), "unknown compose action %q", s.Action)
+			}
+		default:
+			problem(fmt.Sprintf("%q", s.Kind), "unknown kind %q", s.Kind)
+		}
+		switch s.Scope {
+		case "", ScopeSystem, ScopeUser:
+		default:
+			problem(fmt.Sprintf("%q", s.Scope), "unknown scope %q", s.Scope)
+		}
+		switch s.Drift {
+		case "", DriftStash, DriftReset, DriftBlock:
+		default:
+			problem(fmt.Sprintf("%q", s.Drift), "unknown drift policy %q", s.Drift)
+		}
+		for _, p := range s.packages() {
+			name, version := ospkg.Split(p)
+			if name == "" {
+				problem(fmt.Sprintf("%q", p), "package %q has an empty name", p)
+			}
+			if _, err := path.Match(version, ""); err != nil {
+				problem(fmt.Sprintf("%q", p), "package %q has an invalid version: %s", p, err)
+			}
+		}
+		for _, d := range s.Dirs {
+			switch d.Mode {
+			case "", ModeBind, ModeCopy, ModeSymlink:
+			default:
+				problem(fmt.Sprintf("%q", d.Local), "dir %q has unknown mode %q", d.Local, d.Mode)
+			}
+			if err := d.perm().valid(); err != nil {
+				problem(fmt.Sprintf("%q", d.Link), "dir %q has %s", d.Link, err)
+			} else if err := d.perm().writable(s.User); err != nil {
+				problem(fmt.Sprintf("%q", d.Link), "dir %q has %s", d.Link, err)
+			}
+			if d.Manifest != "" && d.File {
+				problem(fmt.Sprintf("%q", d.Link), "dir %q has a manifest, but file is true", d.Link)
+			}
+			if d.Local == "" || !lint {
+				continue
+			}
+		overlap:
+			for _, m := range machines {
+				for _, l := range locals[m] {
+					if overlaps(l.path, d.Local) {
+						problem(fmt.Sprintf("%q", d.Local), "dir %q overlaps with %q of service %q", d.Local, l.path, l.service)
+						break overlap
+					}
+				}
+			}
+			for _, m := range machines {
+				locals[m] = append(locals[m], local{d.Local, s.Service})
+			}
+		}
+		if s.Interval.Duration != 0 && s.Interval.Duration < minInterval {
+			problem("interval", "interval %s is shorter than %s", s.Interval.Duration, minInterval)
+		}
+		for _, w := range s.Window {
+			if err := w.Valid(); err != nil {
+				problem("", "%s", err)
+			}
+		}
+	}
+	return problems
+}
+
+// checkKeys reads and parses all public keys in c, relative paths are taken relative to the config file that
+// defines them, file is the main config file.
+func (c Config) checkKeys(file string) Problems {
+	problems := Problems{}
+	for _, k := range c.Global.Keys {
+		p := k.resolve(file)
+		table := "global"
+		if k.file != "" {
+			table = ""
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			problems = append(problems, Problem{Message: fmt.Sprintf("error reading public key: %s", err), File: k.file, table: table, needle: fmt.Sprintf("%q", k.Path)})
+			continue
+		}
+		if _, _, _, _, err := ssh.ParseAuthorizedKey(data); err != nil {
+			problems = append(problems, Problem{Message: fmt.Sprintf("error parsing public key %q: %s", k.Path, err), File: k.file, table: table, needle: fmt.Sprintf("%q", k.Path)})
+		}
+	}
+	return problems
+}
+
+// checkLinks checks if the links of all services exist in their upstream repository and are of the right type. For
+// each upstream and branch a bare clone is made in a temporary directory.
+func (c Config) checkLinks() Problems {
+	problems := Problems{}
+	global := c.Global
+	if global.Service == nil {
+		global.Service = &Service{}
+	}
+	repos := map[string]*gitcmd.Git{}
+	for i, serv := range c.Services {
+		s := serv.config()
+		s.defaults(global)
+		if s.Upstream == "" {
+			continue
+		}
+		problem := func(needle, format string, a ...interface{}) {
+			problems = append(problems, Problem{Machine: s.Machine, Service: s.Service, Message: fmt.Sprintf(format, a...), File: s.file, table: "services", index: i, pos: s.index, needle: needle})
+		}
+
+		key := s.Upstream + "@" + s.Branch
+		gc, ok := repos[key]
+		if !ok {
+			tmp, err := os.MkdirTemp("", "gitopper-check-")
+			if err != nil {
+				problem("", "%s", err)
+				continue
+			}
+			defer os.RemoveAll(tmp)
+			gc = gitcmd.New(s.Upstream, s.Branch, tmp, "", nil)
+			gc.SetCredentials(s.DeployKey, s.KnownHosts, s.TokenFile)
+			if err := gc.CloneBare(); err != nil {
+				problem("", "error cloning %q at branch %q: %s", s.Upstream, s.Branch, err)
+				gc = nil
+			}
+			repos[key] = gc
+		}
+		if gc == nil {
+			continue
+		}
+
+		for _, d := range s.Dirs {
+			if d.Link == "" {
+				continue
+			}
+			typ, err := gc.Type(d.Link)
+			switch {
+			case err != nil:
+				problem(fmt.Sprintf("%q", d.Link), "error looking up link %q: %s", d.Link, err)
+			case typ == "":
+				problem(fmt.Sprintf("%q", d.Link), "link %q doesn't exist in %q at branch %q", d.Link, s.Upstream, s.Branch)
+			case d.File && typ == "tree":
+				problem(fmt.Sprintf("%q", d.Link), "link %q is a directory, but file is true", d.Link)
+			case !d.File && typ == "blob":
+				problem(fmt.Sprintf("%q", d.Link), "link %q is a file, but file is false", d.Link)
+			}
+		}
+	}
+	return problems
+}
+
+// checkConfig reads and checks the config file and returns all problems found. On top of Check, the public keys are
+// read and parsed and the links of all services are checked to exist in upstream.
+func checkConfig(file string) Problems {
+	c, err := readConfig(file)
+	if err != nil {
+		cerr := &ConfigError{}
+		if errors.As(err, &cerr) {
+			return decodeProblems(cerr.File, cerr.Err)
+		}
+		return Problems{{File: file, Message: err.Error()}}
+	}
+	problems := c.Check()
+	problems = append(problems, c.checkKeys(file)...)
+	problems = append(problems, c.checkLinks()...)
+
+	files := append([]string{file}, c.includes...)
+	order := map[string]int{}
+	docs := map[string][]byte{}
+	for i, f := range files {
+		order[f] = i
+		docs[f], _ = os.ReadFile(f)
+	}
+	for i := range problems {
+		if problems[i].File == "" {
+			problems[i].File = file
+		}
+		problems[i].Line = problems[i].line(docs[problems[i].File])
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return order[problems[i].File] < order[problems[j].File]
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+// decodeProblems returns the problems in the TOML decoding error err.
+func decodeProblems(file string, err error) Problems {
+	serr := &toml.StrictMissingError{}
+	if errors.As(err, &serr) {
+		problems := Problems{}
+		for _, e := range serr.Errors {
+			row, _ := e.Position()
+			problems = append(problems, Problem{File: file, Line: row, Message: fmt.Sprintf("unknown field %q", strings.Join(e.Key(), "."))})
+		}
+		return problems
+	}
+	derr := &toml.DecodeError{}
+	if errors.As(err, &derr) {
+		row, _ := derr.Position()
+		return Problems{{File: file, Line: row, Message: derr.Error()}}
+	}
+	return Problems{{File: file, Message: err.Error()}}
+}
+
+// check checks the config file and writes the problems found to w, as JSON if js is true. If there are problems an
+// error is returned.
+func check(w io.Writer, file string, js bool) error {
+	problems := checkConfig(file)
+	if js {
+		data, err := json.MarshalIndent(problems, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", data)
+	} else {
+		for _, p := range problems {
+			fmt.Fprintln(w, p.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found in %q", len(problems), file)
+	}
+	return nil
+}
+
+// overlaps returns true if a and b are the same path, or one is nested in the other.
+func overlaps(a, b string) bool {
+	a, b = path.Clean(a), path.Clean(b)
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+func contains(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
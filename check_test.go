@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"go.science.ru.nl/log"
+)
+
+func TestCheckConfig(t *testing.T) {
+	log.Discard()
+	upstream := newUpstream(t, map[string]string{
+		"prometheus/etc/prometheus.yml": "global:",
+		"grafana/etc/grafana.ini":       "[server]",
+	})
+	dir := t.TempDir()
+	os.WriteFile(path.Join(dir, "broken.pub"), []byte("not a key"), 0644)
+	conf := `[global]
+upstream = "` + upstream + `"
+mount = "/tmp"
+keys = [
+	{ path = "missing.pub" },
+	{ path = "broken.pub" },
+]
+
+[[services]]
+machine = "localhost"
+service = "prometheus"
+action = "reload"
+dirs = [
+	{ local = "/etc/prometheus", link = "prometheus/etc" },
+	{ local = "/etc/prometheus.yml", link = "prometheus/etc", file = true },
+]
+
+[[services]]
+machine = "localhost"
+service = "prometheus"
+action = "relaod"
+packages = ["prometheus=2.45.[", "promtool"]
+dirs = [
+	{ local = "/etc/prometheus/rules", link = "prometheus/rules" },
+	{ local = "/etc/grafana", link = "grafana/etc/grafana.ini" },
+]
+`
+	file := path.Join(dir, "config.toml")
+	os.WriteFile(file, []byte(conf), 0644)
+
+	problems := checkConfig(file)
+	for _, expect := range []struct {
+		line    int
+		message string
+	}{
+		{5, "error reading public key"},
+		{6, "error parsing public key"},
+		{14, `link "prometheus/etc" is a directory, but file is true`},
+		{18, "duplicate service"},
+		{21, `unknown action "relaod"`},
+		{22, `package "prometheus=2.45.[" has an invalid version`},
+		{24, `dir "/etc/prometheus/rules" overlaps with "/etc/prometheus"`},
+		{24, `link "prometheus/rules" doesn't exist`},
+		{25, `link "grafana/etc/grafana.ini" is a file, but file is false`},
+	} {
+		found := false
+		for _, p := range problems {
+			if p.Line == expect.line && strings.Contains(p.Message, expect.message) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected problem %q on line %d, got:\n%s", expect.message, expect.line, problems)
+		}
+	}
+	if len(problems) != 9 {
+		t.Errorf("expected %d problems, got %d:\n%s", 9, len(problems), problems)
+	}
+}
+
+func TestCheckConfigDecode(t *testing.T) {
+	file := path.Join(t.TempDir(), "config.toml")
+	os.WriteFile(file, []byte("[global]\nmount = \"/tmp\"\n\n[[services]]\nbrokenbranch = \"main\"\n"), 0644)
+
+	problems := checkConfig(file)
+	if len(problems) != 1 || problems[0].Line != 5 {
+		t.Errorf("expected a single problem on line %d, got:\n%s", 5, problems)
+	}
+}
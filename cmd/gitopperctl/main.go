@@ -42,7 +42,7 @@ func main() {
 			{
 				Name:    "list",
 				Aliases: []string{"ls", "l"},
-				Usage:   "list machines, services or a single service",
+				Usage:   "list machines, services, a single service, its history or its stashes",
 				Subcommands: []*cli.Command{
 					{
 						Name:    "machines",
@@ -56,6 +56,18 @@ func main() {
 						Usage:   "list service @machine [<service>]",
 						Action:  cmdService,
 					},
+					{
+						Name:    "history",
+						Aliases: []string{"h"},
+						Usage:   "list history @machine <service>",
+						Action:  cmdHistory,
+					},
+					{
+						Name:    "stash",
+						Aliases: []string{"st"},
+						Usage:   "list stash @machine <service>",
+						Action:  cmdStash,
+					},
 				},
 			},
 			{
@@ -78,14 +90,50 @@ func main() {
 					{
 						Name:    "rollback",
 						Aliases: []string{"r"},
-						Usage:   "do rollback @machine <service> <hash>",
+						Usage:   "do rollback @machine <service> <hash|ref|previous|last-good>",
 						Action:  cmdRollback,
 					},
 					{
 						Name:    "pull",
 						Aliases: []string{"p"},
-						Usage:   "do pull @machine <service>",
+						Usage:   "do pull [--force] @machine <service>",
 						Action:  cmdPull,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "pull even when outside of the maintenance window",
+							},
+						},
+					},
+					{
+						Name:    "ack",
+						Aliases: []string{"a"},
+						Usage:   "do ack @machine <service>",
+						Action:  cmdAck,
+					},
+					{
+						Name:    "checkout",
+						Aliases: []string{"c"},
+						Usage:   "do checkout [--ttl <duration>] @machine <service> <ref>",
+						Action:  cmdCheckout,
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "ttl",
+								Usage: "revert to the configured branch after this duration",
+							},
+						},
+					},
+					{
+						Name:    "restore-stash",
+						Aliases: []string{"rs"},
+						Usage:   "do restore-stash [--patch] @machine <service> <id>",
+						Action:  cmdRestoreStash,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "patch",
+								Usage: "write the stash to a patch file on the machine instead of applying it",
+							},
+						},
 					},
 				},
 			},
@@ -106,11 +154,15 @@ func cmdPull(ctx *cli.Context) error {
 	if service == "" {
 		return fmt.Errorf("need service")
 	}
+	if ctx.Bool("force") {
+		_, err = querySSH(ctx, at, "/do/pull", service, "--force")
+		return err
+	}
 	_, err = querySSH(ctx, at, "/do/pull", service)
 	return err
 }
 
-func cmdRollback(ctx *cli.Context) error {
+func cmdAck(ctx *cli.Context) error {
 	at, err := atMachine(ctx)
 	if err != nil {
 		return err
@@ -119,14 +171,77 @@ func cmdRollback(ctx *cli.Context) error {
 	if service == "" {
 		return fmt.Errorf("need service")
 	}
-	hash := ctx.Args().Get(2)
-	if hash == "" {
-		return fmt.Errorf("need hash to rollback to")
+	_, err = querySSH(ctx, at, "/do/ack", service)
+	return err
+}
+
+func cmdCheckout(ctx *cli.Context) error {
+	at, err := atMachine(ctx)
+	if err != nil {
+		return err
 	}
-	_, err = querySSH(ctx, at, "/do/rollback", service, hash)
+	service := ctx.Args().Get(1)
+	if service == "" {
+		return fmt.Errorf("need service")
+	}
+	ref := ctx.Args().Get(2)
+	if ref == "" {
+		return fmt.Errorf("need branch or ref to checkout")
+	}
+	if ttl := ctx.Duration("ttl"); ttl > 0 {
+		_, err = querySSH(ctx, at, "/do/checkout", service, ref, "--ttl", ttl.String())
+		return err
+	}
+	_, err = querySSH(ctx, at, "/do/checkout", service, ref)
 	return err
 }
 
+func cmdRestoreStash(ctx *cli.Context) error {
+	at, err := atMachine(ctx)
+	if err != nil {
+		return err
+	}
+	service := ctx.Args().Get(1)
+	if service == "" {
+		return fmt.Errorf("need service")
+	}
+	id := ctx.Args().Get(2)
+	if id == "" {
+		return fmt.Errorf("need id of the stash to restore")
+	}
+	if !ctx.Bool("patch") {
+		_, err = querySSH(ctx, at, "/do/restore-stash", service, id)
+		return err
+	}
+	body, err := querySSH(ctx, at, "/do/restore-stash", service, id, "--patch")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+func cmdRollback(ctx *cli.Context) error {
+	at, err := atMachine(ctx)
+	if err != nil {
+		return err
+	}
+	service := ctx.Args().Get(1)
+	if service == "" {
+		return fmt.Errorf("need service")
+	}
+	ref := ctx.Args().Get(2)
+	if ref == "" {
+		return fmt.Errorf("need hash or ref to rollback to")
+	}
+	body, err := querySSH(ctx, at, "/do/rollback", service, ref)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
 func cmdUnfreeze(ctx *cli.Context) error {
 	at, err := atMachine(ctx)
 	if err != nil {
@@ -182,9 +297,71 @@ func cmdService(ctx *cli.Context) error {
 	}
 	tbl := new(tabwriter.Writer)
 	tbl.Init(os.Stdout, 0, 8, 1, ' ', 0)
-	tblPrint(tbl, []string{"#", "SERVICE", "HASH", "STATE", "INFO", "SINCE"})
+	tblPrint(tbl, []string{"#", "SERVICE", "HASH", "STATE", "INFO", "SINCE", "WINDOW", "NEXT", "DRIFT", "PIN"})
 	for i, ls := range ls.ListServices {
-		tblPrint(tbl, []string{strconv.FormatInt(int64(i), 10), ls.Service, ls.Hash, ls.State, ls.StateInfo, ls.StateChange})
+		tblPrint(tbl, []string{strconv.FormatInt(int64(i), 10), ls.Service, ls.Hash, ls.State, ls.StateInfo, ls.StateChange, ls.Window, ls.Next, strings.Join(ls.Drift, ","), ls.Pin})
+	}
+	_ = tbl.Flush()
+	return nil
+}
+
+func cmdHistory(ctx *cli.Context) error {
+	at, err := atMachine(ctx)
+	if err != nil {
+		return err
+	}
+	service := ctx.Args().Get(1)
+	if service == "" {
+		return fmt.Errorf("need service")
+	}
+	body, err := querySSH(ctx, at, "/list/history", service)
+	if err != nil {
+		return err
+	}
+	lh := proto.ListHistory{}
+	if err := json.Unmarshal(body, &lh); err != nil {
+		return err
+	}
+	if ctx.Bool("m") {
+		fmt.Print(string(body))
+		return nil
+	}
+	tbl := new(tabwriter.Writer)
+	tbl.Init(os.Stdout, 0, 8, 1, ' ', 0)
+	tblPrint(tbl, []string{"#", "TIME", "EVENT"})
+	for i, e := range lh.History {
+		tblPrint(tbl, []string{strconv.FormatInt(int64(i), 10), e.Time, e.Message})
+	}
+	_ = tbl.Flush()
+	return nil
+}
+
+func cmdStash(ctx *cli.Context) error {
+	at, err := atMachine(ctx)
+	if err != nil {
+		return err
+	}
+	service := ctx.Args().Get(1)
+	if service == "" {
+		return fmt.Errorf("need service")
+	}
+	body, err := querySSH(ctx, at, "/list/stash", service)
+	if err != nil {
+		return err
+	}
+	ls := proto.ListStashes{}
+	if err := json.Unmarshal(body, &ls); err != nil {
+		return err
+	}
+	if ctx.Bool("m") {
+		fmt.Print(string(body))
+		return nil
+	}
+	tbl := new(tabwriter.Writer)
+	tbl.Init(os.Stdout, 0, 8, 1, ' ', 0)
+	tblPrint(tbl, []string{"#", "ID", "TIME", "HASH", "FILES"})
+	for i, st := range ls.Stashes {
+		tblPrint(tbl, []string{strconv.FormatInt(int64(i), 10), st.ID, st.Time, st.Hash, strings.Join(st.Files, ",")})
 	}
 	_ = tbl.Flush()
 	return nil
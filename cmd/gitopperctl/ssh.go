@@ -61,6 +61,9 @@ func querySSH(ctx *cli.Context, at, command string, args ...string) ([]byte, err
 
 	cmdline := command + " " + strings.Join(args, " ")
 	if err := ss.Run(cmdline); err != nil {
+		if stdoutBuf.Len() > 0 {
+			return nil, fmt.Errorf("%s: %s", err, stdoutBuf.Bytes())
+		}
 		return nil, err
 	}
 	return stdoutBuf.Bytes(), nil
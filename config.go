@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -17,54 +19,132 @@ import (
 
 // Config holds the gitopper config file. It's is updated every so often to pick up new changes.
 type Config struct {
+	Include  []string // Glob patterns of config files to include, relative to this config file.
 	Global   `toml:"global"`
 	Services []*Service
+
+	labels   map[string]string // labels of this host, see --labels
+	includes []string          // the included config files
 }
 
 type Global struct {
 	*Service
-	Keys []*Key
+	Keys   []*Key
+	Groups map[string][]string // Named groups of machines (or glob patterns), used as "@group" in machines.
 }
 
 type Key struct {
 	Path          string
 	RO            bool `toml:"ro"` // treat key as ro, and disallow "write" commands
 	ssh.PublicKey `toml:"-"`
+
+	file string // included config file this key is defined in, empty for the main config file
+}
+
+// resolve returns the path of the public key of k, a relative path is taken relative to the directory of the config
+// file that defines k: the included file k is defined in, or file for the main config file.
+func (k *Key) resolve(file string) string {
+	if path.IsAbs(k.Path) {
+		return k.Path
+	}
+	if k.file != "" {
+		file = k.file
+	}
+	return path.Join(path.Dir(file), k.Path)
 }
 
+// include is an included config file, these may only define services and keys.
+type include struct {
+	Services []*Service
+	Keys     []*Key
+}
+
+// ConfigError is an error in a config file.
+type ConfigError struct {
+	File string
+	Err  error
+}
+
+func (e *ConfigError) Error() string { return fmt.Sprintf("%s: %s", e.File, e.Err) }
+func (e *ConfigError) Unwrap() error { return e.Err }
+
 func parseConfig(doc []byte) (c Config, err error) {
 	t := toml.NewDecoder(bytes.NewReader(doc))
 	t.DisallowUnknownFields()
 	err = t.Decode(&c)
+	for i := range c.Services {
+		c.Services[i].index = i
+	}
 	return c, err
 }
 
-// Valid checks the config in c and returns nil of all mandatory fields have been set.
-func (c Config) Valid() error {
-	if len(c.Global.Keys) == 0 {
-		return fmt.Errorf("at least one public key should be specified")
+// readConfig reads and parses the config file and all the files it includes. The services and keys of the included
+// files are added to the returned config. Errors are returned as a *ConfigError.
+func readConfig(file string) (Config, error) {
+	doc, err := os.ReadFile(file)
+	if err != nil {
+		return Config{}, &ConfigError{file, err}
 	}
-
-	for i, serv := range c.Services {
-		s := serv.merge(c.Global)
-		if s.Machine == "" {
-			return fmt.Errorf("machine #%d, has empty machine name", i)
+	c, err := parseConfig(doc)
+	if err != nil {
+		return c, &ConfigError{file, err}
+	}
+	c.includes, err = includes(file, c.Include)
+	if err != nil {
+		return c, &ConfigError{file, err}
+	}
+	for _, f := range c.includes {
+		doc, err := os.ReadFile(f)
+		if err != nil {
+			return c, &ConfigError{f, err}
+		}
+		inc := include{}
+		t := toml.NewDecoder(bytes.NewReader(doc))
+		t.DisallowUnknownFields()
+		if err := t.Decode(&inc); err != nil {
+			return c, &ConfigError{f, err}
 		}
-		if s.Upstream == "" {
-			return fmt.Errorf("machine #%d %q, has empty upstream", i, s.Machine)
+		for i, s := range inc.Services {
+			s.file, s.index = f, i
 		}
-		if s.Mount == "" {
-			return fmt.Errorf("machine #%d %q, has empty mount", i, s.Machine)
+		for _, k := range inc.Keys {
+			k.file = f
+		}
+		c.Services = append(c.Services, inc.Services...)
+		c.Keys = append(c.Keys, inc.Keys...)
+	}
+	return c, nil
+}
+
+// includes returns the files matching the glob patterns, relative patterns are taken relative to the directory of
+// file. The files of each pattern are sorted.
+func includes(file string, patterns []string) ([]string, error) {
+	files := []string{}
+	for _, p := range patterns {
+		if !path.IsAbs(p) {
+			p = path.Join(path.Dir(file), p)
 		}
-		if s.Service == "" {
-			return fmt.Errorf("machine #%d %q, has empty service", i, s.Service)
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include %q: %s", p, err)
 		}
+		files = append(files, matches...) // Glob returns the matches sorted
+	}
+	return files, nil
+}
+
+// Valid checks the config in c and returns nil if all mandatory fields have been set and no problems are found,
+// otherwise the Problems are returned. Services in c are not changed. Unlike Check, problems that don't stop us
+// from running the config aren't reported.
+func (c Config) Valid() error {
+	if problems := c.problems(false); len(problems) > 0 {
+		return problems
 	}
 	return nil
 }
 
-// trackConfig will sha1 sum the contents of file and if it differs from previous runs, will SIGHUP ourselves so we
-// exist with status code 2, which in turn will systemd restart us again.
+// trackConfig will sha1 sum the contents of file and the files it includes and if it differs from previous runs,
+// will SIGHUP ourselves so we exist with status code 2, which in turn will systemd restart us again.
 func trackConfig(ctx context.Context, file string, done chan<- os.Signal) {
 	hash := ""
 	for {
@@ -80,6 +160,18 @@ func trackConfig(ctx context.Context, file string, done chan<- os.Signal) {
 		}
 		sha := sha1.New()
 		sha.Write(doc)
+		c := Config{}
+		if err := toml.Unmarshal(doc, &c); err == nil {
+			files, _ := includes(file, c.Include)
+			for _, f := range files {
+				inc, err := ioutil.ReadFile(f)
+				if err != nil {
+					log.Warningf("Failed to read config %q: %s", f, err)
+				}
+				sha.Write([]byte(f))
+				sha.Write(inc)
+			}
+		}
 		hash1 := string(sha.Sum(nil))
 		if hash == "" {
 			hash = hash1
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"os"
+	"path"
+	"strings"
 	"testing"
+
+	"github.com/miekg/gitopper/ossvc"
 )
 
 func TestValidConfig(t *testing.T) {
@@ -54,3 +59,123 @@ service = "prometheus"
 		t.Fatalf("expected to fail to parse config, but got nil error")
 	}
 }
+
+func TestValidDoesNotMerge(t *testing.T) {
+	const conf = `
+[global]
+upstream = "https://github.com/miekg/gitopper-config"
+mount = "/tmp"
+keys = [ { path = "keys/miek.pub" } ]
+
+[[services]]
+machine = "localhost"
+service = "prometheus"
+`
+	c, err := parseConfig([]byte(conf))
+	if err != nil {
+		t.Fatalf("expected to parse config, but got: %s", err)
+	}
+	if err := c.Valid(); err != nil {
+		t.Fatalf("expected config to be valid, but got: %s", err)
+	}
+	if c.Services[0].Mount != "" || c.Services[0].Upstream != "" {
+		t.Errorf("expected service to be unchanged, got mount %q and upstream %q", c.Services[0].Mount, c.Services[0].Upstream)
+	}
+}
+
+func TestReadConfigInclude(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(path.Join(dir, "services.d"), 0755)
+	os.WriteFile(path.Join(dir, "config.toml"), []byte(`include = ["services.d/*.toml"]
+
+[global]
+upstream = "https://github.com/miekg/gitopper-config"
+mount = "/tmp"
+`), 0644)
+	os.WriteFile(path.Join(dir, "services.d", "grafana.toml"), []byte(`keys = [ { path = "keys/grafana.pub" } ]
+
+[[services]]
+machine = "localhost"
+service = "grafana"
+`), 0644)
+	os.WriteFile(path.Join(dir, "services.d", "prometheus.toml"), []byte(`[[services]]
+machine = "localhost"
+service = "prometheus"
+scope = "sytem"
+`), 0644)
+
+	c, err := readConfig(path.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatalf("expected to read config, but got: %s", err)
+	}
+	if len(c.Services) != 2 || len(c.Keys) != 1 {
+		t.Fatalf("expected %d services and %d key, got %d and %d", 2, 1, len(c.Services), len(c.Keys))
+	}
+	// a relative key path is taken relative to the file that defines it.
+	if p := c.Keys[0].resolve(path.Join(dir, "config.toml")); p != path.Join(dir, "services.d", "keys/grafana.pub") {
+		t.Errorf("expected key path %q, got %q", path.Join(dir, "services.d", "keys/grafana.pub"), p)
+	}
+	if p := (&Key{Path: "keys/miek.pub"}).resolve(path.Join(dir, "config.toml")); p != path.Join(dir, "keys/miek.pub") {
+		t.Errorf("expected key path %q, got %q", path.Join(dir, "keys/miek.pub"), p)
+	}
+	err = c.Valid()
+	if err == nil || !strings.Contains(err.Error(), "prometheus.toml") {
+		t.Errorf("expected error to cite %q, got: %v", "prometheus.toml", err)
+	}
+	problems := checkConfig(path.Join(dir, "config.toml"))
+	found := false
+	for _, p := range problems {
+		if strings.HasSuffix(p.File, "prometheus.toml") && p.Line == 4 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected problem on line %d of %q, got:\n%s", 4, "prometheus.toml", problems)
+	}
+
+	os.WriteFile(path.Join(dir, "services.d", "global.toml"), []byte("[global]\nmount = \"/srv\"\n"), 0644)
+	_, err = readConfig(path.Join(dir, "config.toml"))
+	if err == nil || !strings.Contains(err.Error(), "global.toml") {
+		t.Errorf("expected error to cite %q, got: %v", "global.toml", err)
+	}
+}
+
+func TestValidLint(t *testing.T) {
+	const conf = `
+[global]
+upstream = "https://github.com/miekg/gitopper-config"
+mount = "/tmp"
+keys = [ { path = "keys/miek.pub" } ]
+
+[[services]]
+machine = "localhost"
+service = "prometheus"
+manager = "openrc"
+action = "reload-or-restart"
+dirs = [
+    { local = "/etc/prometheus", link = "prometheus/etc" },
+    { local = "/etc/prometheus/rules", link = "prometheus/rules" },
+]
+`
+	c, err := parseConfig([]byte(conf))
+	if err != nil {
+		t.Fatalf("expected to parse config, but got: %s", err)
+	}
+	if err := c.Valid(); err != nil {
+		t.Errorf("expected config to be valid, but got: %s", err)
+	}
+	if problems := c.Check(); len(problems) != 2 {
+		t.Errorf("expected %d problems from check, got %d:\n%s", 2, len(problems), problems)
+	}
+}
+
+func TestComposeDefaultAction(t *testing.T) {
+	s := (&Service{Service: "caddy", Kind: KindCompose, mgr: &ossvc.Fake{}}).merge(Global{Service: &Service{}})
+	if s.Action != "up" {
+		t.Errorf("expected compose action %q, got %q", "up", s.Action)
+	}
+	s = (&Service{Service: "prometheus", mgr: &ossvc.Fake{}}).merge(Global{Service: &Service{}})
+	if s.Action != "" {
+		t.Errorf("expected no action, got %q", s.Action)
+	}
+}
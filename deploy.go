@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+// copy syncs the files from the git repo to d.Local. Like a bind mount, d.Local will be an exact copy: files that
+// don't exist in the repo are removed. The number of changed files is returned.
+func (s *Service) copy(d Dir) (int, error) {
+	src := s.source(d)
+	if !d.File {
+		if err := os.MkdirAll(d.Local, 0775); err != nil {
+			return 0, fmt.Errorf("failed to create directory %q: %s", d.Local, err)
+		}
+		n, err := syncTree(src, d.Local, nil)
+		if err != nil {
+			return n, fmt.Errorf("failed to copy %q to %q: %s", src, d.Local, err)
+		}
+		return n, nil
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return 0, err
+	}
+	written, err := writeFile(d.Local, data, info)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy %q to %q: %s", src, d.Local, err)
+	}
+	if written {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// symlink makes d.Local a symlink to the file or directory in the git repo. If d.Local exists and isn't a symlink an
+// error is returned. It returns true if the symlink was created or changed.
+func (s *Service) symlink(d Dir) (bool, error) {
+	src := s.source(d)
+	info, err := os.Lstat(d.Local)
+	if err == nil && info.Mode()&os.ModeSymlink == 0 {
+		return false, fmt.Errorf("failed to symlink %q: exists and is not a symlink", d.Local)
+	}
+	if cur, err := os.Readlink(d.Local); err == nil && cur == src {
+		return false, nil
+	}
+	if err := os.MkdirAll(path.Dir(d.Local), 0775); err != nil {
+		return false, fmt.Errorf("failed to create directory %q: %s", path.Dir(d.Local), err)
+	}
+	// Create the symlink under a temporary name and rename it, so d.Local never disappears.
+	tmp := path.Join(path.Dir(d.Local), "."+path.Base(d.Local)+".gitopper")
+	os.Remove(tmp)
+	if err := os.Symlink(src, tmp); err != nil {
+		return false, fmt.Errorf("failed to symlink %q: %s", d.Local, err)
+	}
+	if err := os.Rename(tmp, d.Local); err != nil {
+		os.Remove(tmp)
+		return false, fmt.Errorf("failed to symlink %q: %s", d.Local, err)
+	}
+	return true, nil
+}
+
+// copied returns true if s has dirs with a local path and all of them are copies. Only then does deploy know if
+// anything changed; bind mounts and symlinks see changes in the git repo directly, and without local paths the
+// service uses the git repo itself.
+func (s *Service) copied() bool {
+	n := 0
+	for _, d := range s.Dirs {
+		if d.Local == "" {
+			continue
+		}
+		if d.Mode != ModeCopy {
+			return false
+		}
+		n++
+	}
+	return n > 0
+}
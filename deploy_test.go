@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"go.science.ru.nl/log"
+)
+
+func TestDeployCopy(t *testing.T) {
+	log.Discard()
+	mount := t.TempDir()
+	local := path.Join(t.TempDir(), "etc")
+	s := &Service{
+		Service: "test-service",
+		Mount:   mount,
+		Dirs:    []Dir{{Local: local, Link: "prometheus/etc", Mode: ModeCopy}},
+	}
+	gitdir := path.Join(mount, s.Service, "prometheus/etc")
+	os.MkdirAll(path.Join(gitdir, "rules"), 0755)
+	os.WriteFile(path.Join(gitdir, "prometheus.yml"), []byte("global:"), 0644)
+	os.WriteFile(path.Join(gitdir, "rules", "alerts.yml"), []byte("groups:"), 0600)
+
+	changes, err := s.deploy()
+	if err != nil {
+		t.Fatalf("expected to deploy, got: %s", err)
+	}
+	if changes != 1 {
+		t.Errorf("expected %d changed dirs, got %d", 1, changes)
+	}
+	if info, err := os.Stat(path.Join(local, "rules", "alerts.yml")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected %q to be copied with mode %o", "rules/alerts.yml", 0600)
+	}
+
+	if changes, _ := s.deploy(); changes != 0 {
+		t.Errorf("expected %d changed dirs, got %d", 0, changes)
+	}
+
+	os.Remove(path.Join(gitdir, "rules", "alerts.yml"))
+	if changes, _ := s.deploy(); changes != 1 {
+		t.Errorf("expected %d changed dirs, got %d", 1, changes)
+	}
+	if exists(path.Join(local, "rules", "alerts.yml")) {
+		t.Errorf("expected %q to be removed", "rules/alerts.yml")
+	}
+}
+
+func TestDeploySymlink(t *testing.T) {
+	mount := t.TempDir()
+	local := path.Join(t.TempDir(), "etc")
+	s := &Service{
+		Service: "test-service",
+		Mount:   mount,
+		Dirs:    []Dir{{Local: local, Link: "prometheus/etc", Mode: ModeSymlink}},
+	}
+	os.MkdirAll(path.Join(mount, s.Service, "prometheus/etc"), 0755)
+
+	if changes, err := s.deploy(); err != nil || changes != 1 {
+		t.Fatalf("expected to deploy %d changes, got %d: %v", 1, changes, err)
+	}
+	if changes, err := s.deploy(); err != nil || changes != 0 {
+		t.Fatalf("expected to deploy %d changes, got %d: %v", 0, changes, err)
+	}
+	if link, _ := os.Readlink(local); link != s.source(s.Dirs[0]) {
+		t.Errorf("expected symlink to %q, got %q", s.source(s.Dirs[0]), link)
+	}
+
+	os.Remove(local)
+	os.Mkdir(local, 0755)
+	if _, err := s.deploy(); err == nil {
+		t.Errorf("expected error when local is not a symlink, got none")
+	}
+}
+
+func TestSetRootless(t *testing.T) {
+	s := &Service{Dirs: []Dir{{Local: "/etc/prometheus"}, {Local: "/etc/grafana", Mode: ModeSymlink}}}
+	if err := s.setRootless(); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if s.Dirs[0].Mode != ModeCopy || s.Dirs[1].Mode != ModeSymlink {
+		t.Errorf("expected modes %q and %q, got %q and %q", ModeCopy, ModeSymlink, s.Dirs[0].Mode, s.Dirs[1].Mode)
+	}
+	if s.Scope != ScopeUser {
+		t.Errorf("expected scope %q, got %q", ScopeUser, s.Scope)
+	}
+
+	s = &Service{Dirs: []Dir{{Local: "/etc/prometheus", Mode: ModeBind}}}
+	if err := s.setRootless(); err == nil {
+		t.Fatalf("expected error for bind mount, got none")
+	}
+}
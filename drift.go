@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/gitopper/gitcmd"
+	"go.science.ru.nl/log"
+)
+
+// Drift policies of a Service, what to do with local changes in the git repo.
+const (
+	DriftStash = "stash" // stash the changes when pulling (default)
+	DriftReset = "reset" // throw the changes away
+	DriftBlock = "block" // don't pull until the changes are acknowledged
+)
+
+// DriftFiles returns the files with local changes, as seen by the last check.
+func (s *Service) DriftFiles() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.drift
+}
+
+// setDrift sets the files with local changes.
+func (s *Service) setDrift(files []string) {
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strings.Join(files, "\n") != strings.Join(s.drift, "\n") && len(files) > 0 {
+		s.record("local changes in %s", strings.Join(files, ", "))
+	}
+	s.drift = files
+
+	metricServiceDrift.WithLabelValues(s.Service).Set(float64(len(files)))
+}
+
+// Ack acknowledges the local changes, so a service with the block drift policy is pulled again. The changes are
+// stashed.
+func (s *Service) Ack() {
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked = true
+	s.record("local changes acknowledged")
+}
+
+// drifted checks the git repo for local changes and handles them according to the drift policy of s. It returns true
+// if s should not be pulled. The changes of a frozen service are only reported.
+func (s *Service) drifted(gc *gitcmd.Git) bool {
+	files, err := gc.Status()
+	if err != nil {
+		log.Warningf("Service %q, error checking local changes in %q: %s", s.Service, gc.Repo(), err)
+		return false
+	}
+	s.setDrift(files)
+
+	state, _ := s.State()
+	if len(files) == 0 {
+		if state == StateDrift {
+			s.SetState(StateOK, "")
+		}
+		return false
+	}
+	log.Warningf("Service %q, local changes in %q: %v", s.Service, gc.Repo(), files)
+	// a frozen service isn't pulled, so its local changes are left alone.
+	if state == StateFreeze {
+		return true
+	}
+
+	switch s.Drift {
+	case DriftReset:
+		if err := gc.Reset(); err != nil {
+			log.Warningf("Service %q, error resetting local changes in %q: %s", s.Service, gc.Repo(), err)
+			s.SetState(StateDrift, fmt.Sprintf("error resetting local changes: %s", err))
+			return true
+		}
+		s.Record("reset local changes")
+		s.setDrift(nil)
+	case DriftBlock:
+		s.mu.Lock()
+		acked := s.acked
+		s.acked = false
+		s.mu.Unlock()
+		if acked {
+			if err := gc.Stash(); err != nil {
+				log.Warningf("Service %q, error stashing local changes in %q: %s", s.Service, gc.Repo(), err)
+				s.SetState(StateDrift, fmt.Sprintf("error stashing local changes: %s", err))
+				return true
+			}
+			s.Record("stashed local changes")
+			s.setDrift(nil)
+			if state == StateDrift {
+				s.SetState(StateOK, "")
+			}
+			return false
+		}
+		if state == StateOK || state == StateDrift {
+			s.SetState(StateDrift, fmt.Sprintf("local changes in %d files, not pulling", len(files)))
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/miekg/gitopper/ossvc"
+	"go.science.ru.nl/log"
+)
+
+func TestDrift(t *testing.T) {
+	log.Discard()
+	for _, policy := range []string{DriftStash, DriftReset, DriftBlock} {
+		upstream := newUpstream(t, map[string]string{"prometheus/etc/prometheus.yml": "v1"})
+		s := &Service{
+			Upstream: upstream,
+			Service:  "prometheus",
+			Mount:    t.TempDir(),
+			Action:   "reload",
+			Drift:    policy,
+			Dirs:     []Dir{{Link: "prometheus/etc"}},
+			mgr:      &ossvc.Fake{},
+		}
+		s = s.merge(Global{Service: &Service{}})
+		gc := s.newGitCmd()
+		if err := gc.Checkout(); err != nil {
+			t.Fatal(err)
+		}
+		file := path.Join(gc.Repo(), "prometheus/etc/prometheus.yml")
+		os.WriteFile(file, []byte("edited"), 0644)
+		commit(t, upstream, map[string]string{"prometheus/etc/prometheus.yml": "v2"})
+
+		s.update(gc, false)
+		if drift := s.DriftFiles(); policy != DriftReset && (len(drift) != 1 || drift[0] != "prometheus/etc/prometheus.yml") {
+			t.Errorf("policy %q, expected drift in %q, got %v", policy, "prometheus/etc/prometheus.yml", drift)
+		}
+		state, _ := s.State()
+		buf, _ := os.ReadFile(file)
+		switch policy {
+		case DriftStash, DriftReset:
+			if state != StateOK || string(buf) != "v2" {
+				t.Errorf("policy %q, expected state %s and %q, got %s and %q", policy, StateOK, "v2", state, buf)
+			}
+		case DriftBlock:
+			if state != StateDrift || string(buf) != "edited" {
+				t.Errorf("policy %q, expected state %s and %q, got %s and %q", policy, StateDrift, "edited", state, buf)
+			}
+			s.Ack()
+			s.update(gc, false)
+			state, _ := s.State()
+			buf, _ := os.ReadFile(file)
+			if state != StateOK || string(buf) != "v2" || len(s.DriftFiles()) != 0 {
+				t.Errorf("policy %q, expected state %s and %q after ack, got %s and %q", policy, StateOK, "v2", state, buf)
+			}
+		}
+	}
+}
+
+func TestDriftFrozen(t *testing.T) {
+	log.Discard()
+	upstream := newUpstream(t, map[string]string{"prometheus/etc/prometheus.yml": "v1"})
+	s := &Service{
+		Upstream: upstream,
+		Service:  "prometheus",
+		Mount:    t.TempDir(),
+		Drift:    DriftReset,
+		Dirs:     []Dir{{Link: "prometheus/etc"}},
+		mgr:      &ossvc.Fake{},
+	}
+	s = s.merge(Global{Service: &Service{}})
+	gc := s.newGitCmd()
+	if err := gc.Checkout(); err != nil {
+		t.Fatal(err)
+	}
+	file := path.Join(gc.Repo(), "prometheus/etc/prometheus.yml")
+	os.WriteFile(file, []byte("edited"), 0644)
+	s.SetState(StateFreeze, "")
+
+	s.update(gc, false)
+	buf, _ := os.ReadFile(file)
+	if state, _ := s.State(); state != StateFreeze || string(buf) != "edited" || len(s.DriftFiles()) != 1 {
+		t.Errorf("expected state %s, %q and reported drift, got %s, %q and %v", StateFreeze, "edited", state, buf, s.DriftFiles())
+	}
+}
+
+func TestDriftUntracked(t *testing.T) {
+	log.Discard()
+	for _, policy := range []string{DriftStash, DriftBlock} {
+		upstream := newUpstream(t, map[string]string{"prometheus/etc/prometheus.yml": "v1"})
+		s := &Service{
+			Upstream: upstream,
+			Service:  "prometheus",
+			Mount:    t.TempDir(),
+			Drift:    policy,
+			Dirs:     []Dir{{Link: "prometheus/etc"}},
+			mgr:      &ossvc.Fake{},
+		}
+		s = s.merge(Global{Service: &Service{}})
+		gc := s.newGitCmd()
+		if err := gc.Checkout(); err != nil {
+			t.Fatal(err)
+		}
+		file := path.Join(gc.Repo(), "prometheus/etc/rules.yml")
+		os.WriteFile(file, []byte("rules"), 0644)
+
+		s.update(gc, false)
+		if drift := s.DriftFiles(); len(drift) != 1 || drift[0] != "prometheus/etc/rules.yml" {
+			t.Errorf("policy %q, expected drift in %q, got %v", policy, "prometheus/etc/rules.yml", drift)
+		}
+		if policy == DriftBlock {
+			s.Ack()
+			s.update(gc, false)
+		}
+		// the untracked file is stashed, so the next round doesn't see it again.
+		s.update(gc, false)
+		if state, _ := s.State(); state != StateOK || len(s.DriftFiles()) != 0 || exists(file) {
+			t.Errorf("policy %q, expected state %s and no drift, got %s and %v", policy, StateOK, state, s.DriftFiles())
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package gitcmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SetCredentials makes g use the credentials from the given files when talking to upstream. Key is an SSH private
+// (deploy) key, knownHosts the known_hosts file with the host key of upstream, if empty the default known_hosts
+// of the user is used; host keys are always checked strictly. TokenFile holds a token that is used as the
+// password for HTTPS upstreams. Empty files are not used. The files must be readable for the user running git.
+func (g *Git) SetCredentials(key, knownHosts, tokenFile string) {
+	g.key = key
+	g.knownHosts = knownHosts
+	g.tokenFile = tokenFile
+}
+
+// credentials returns the extra arguments and environment needed to use the credentials of g.
+func (g *Git) credentials() (args, env []string) {
+	if g.key != "" {
+		ssh := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes", quote(g.key))
+		if g.knownHosts != "" {
+			ssh += " -o UserKnownHostsFile=" + quote(g.knownHosts)
+		}
+		env = append(env, "GIT_SSH_COMMAND="+ssh)
+	}
+	if g.tokenFile != "" {
+		// the token is only read by the helper, so it never shows up in any arguments.
+		helper := fmt.Sprintf(`!f() { test "$1" = get && echo username=x-access-token && echo "password=$(cat %s)"; }; f`, quote(g.tokenFile))
+		args = append(args, "-c", "credential.helper=", "-c", "credential.helper="+helper)
+	}
+	return args, env
+}
+
+// quote quotes s for use in a shell command.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// redact returns a copy of args where passwords in URLs are replaced with "xxxxx", so they can be logged.
+func redact(args []string) []string {
+	r := make([]string, len(args))
+	for i, a := range args {
+		r[i] = a
+		u, err := url.Parse(a)
+		if err != nil || u.User == nil {
+			continue
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			r[i] = u.String()
+		}
+	}
+	return r
+}
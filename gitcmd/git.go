@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 	"syscall"
 
 	"github.com/miekg/gitopper/osutil"
@@ -21,6 +22,16 @@ type Git struct {
 	mount    string
 	dirs     []string
 	user     string
+	group    string // group to use with user, see SetGroup
+	mirror   string // bare mirror to clone and fetch from, see SetMirror
+	fetch    bool   // fetch the mirror on its next use, see FetchMirror
+
+	key        string // ssh key, see SetCredentials
+	knownHosts string // known_hosts file for key
+	tokenFile  string // file with the token for https
+
+	keep     int    // number of stashes to keep, see SetKeepStashes
+	detached string // ref HEAD is detached at, see Switch
 
 	cwd string
 }
@@ -38,18 +49,30 @@ func New(upstream, branch, mount, user string, dirs []string) *Git {
 	return g
 }
 
+// SetGroup sets the group git is run as, by default this is the primary group of the user.
+func (g *Git) SetGroup(group string) { g.group = group }
+
 func (g *Git) run(args ...string) ([]byte, error) {
 	ctx := context.TODO()
-	cmd := exec.CommandContext(ctx, "git", args...)
+	if g.mirror != "" { // the mirror is likely owned by another user
+		args = append([]string{"-c", "safe.directory=" + g.mirror}, args...)
+	}
+	// modes of files may be changed on purpose (see the permissions of dirs), git should leave them alone.
+	args = append([]string{"-c", "core.fileMode=false"}, args...)
+	cargs, cenv := g.credentials()
+	cmd := exec.CommandContext(ctx, "git", append(cargs, args...)...)
 	cmd.Dir = g.cwd
-	cmd.Env = []string{"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_SYSTEM=/dev/null"}
+	cmd.Env = append([]string{"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_SYSTEM=/dev/null"}, cenv...)
 	if g.user != "" {
-		uid, gid := osutil.User(g.user)
+		uid, gid, err := osutil.User(g.user, g.group)
+		if err != nil {
+			return nil, err
+		}
 		cmd.SysProcAttr = &syscall.SysProcAttr{}
 		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
 	}
 
-	log.Debugf("running in %q as %q %v", cmd.Dir, g.user, cmd.Args)
+	log.Debugf("running in %q as %q %v", cmd.Dir, g.user, redact(cmd.Args))
 
 	out, err := cmd.CombinedOutput()
 	if len(out) > 0 {
@@ -85,7 +108,10 @@ func (g *Git) Checkout() error {
 	}
 
 	if os.Geteuid() == 0 { // set g.mount to the correct owner, if we are root
-		uid, gid := osutil.User(g.user)
+		uid, gid, err := osutil.User(g.user, g.group)
+		if err != nil {
+			return fmt.Errorf("failed to chown directory %q: %s", g.mount, err)
+		}
 		if err := os.Chown(g.mount, int(uid), int(gid)); err != nil {
 			log.Errorf("Directory %q can not be chown-ed to %q: %s", g.mount, g.user, err)
 			return fmt.Errorf("failed to chown directory %q to %q: %s", g.mount, g.user, err)
@@ -93,7 +119,15 @@ func (g *Git) Checkout() error {
 	}
 
 	g.cwd = ""
-	_, err := g.run("clone", "-b", g.branch, "--filter=blob:none", "--no-checkout", "--sparse", g.upstream, g.mount)
+	var err error
+	if g.mirror != "" {
+		if err := g.updateMirror(); err != nil {
+			return err
+		}
+		_, err = g.run("clone", "--shared", "-b", g.branch, "--no-checkout", "--sparse", g.mirror, g.mount)
+	} else {
+		_, err = g.run("clone", "-b", g.branch, "--filter=blob:none", "--no-checkout", "--sparse", g.upstream, g.mount)
+	}
 	if err != nil {
 		return err
 	}
@@ -111,12 +145,22 @@ func (g *Git) Checkout() error {
 	return err
 }
 
-// Pull pulls from upstream. If the returned bool is true there were updates.
+// Pull pulls from upstream. If the returned bool is true there were updates. Nothing is pulled when HEAD is
+// detached, see Switch.
 func (g *Git) Pull() (bool, error) {
+	if g.detached != "" {
+		return false, nil
+	}
 	if err := g.Stash(); err != nil {
 		return false, err
 	}
 
+	if g.mirror != "" {
+		if err := g.updateMirror(); err != nil {
+			return false, err
+		}
+	}
+
 	g.cwd = g.mount
 	defer func() { g.cwd = "" }()
 
@@ -133,6 +177,71 @@ func (g *Git) Pull() (bool, error) {
 	return g.OfInterest(out), nil
 }
 
+// Fetch fetches from upstream, but doesn't merge. If upstream has changes we are interested in, the hash of
+// upstream is returned, otherwise the empty string. The hash is always truncated to 8 hex digits.
+func (g *Git) Fetch() (string, error) {
+	if g.detached != "" {
+		return "", nil
+	}
+	if g.mirror != "" {
+		if err := g.updateMirror(); err != nil {
+			return "", err
+		}
+	}
+
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+
+	if _, err := g.run("fetch"); err != nil {
+		return "", err
+	}
+	out, err := g.run("diff", "--stat=4096", "--name-only", g.branch, fmt.Sprintf("origin/%s", g.branch))
+	if err != nil {
+		return "", err
+	}
+	if !g.OfInterest(out) {
+		return "", nil
+	}
+	out, err = g.run("rev-parse", fmt.Sprintf("origin/%s", g.branch))
+	if err != nil {
+		return "", err
+	}
+	if len(out) < 8 {
+		return "", nil
+	}
+	return string(out)[:8], nil
+}
+
+// Incoming fetches from upstream, but doesn't merge. It returns the commits (hash and subject) a pull would
+// bring in that touch the dirs we are interested in, newest first.
+func (g *Git) Incoming() ([]string, error) {
+	if g.detached != "" {
+		return nil, nil
+	}
+	if g.mirror != "" {
+		if err := g.updateMirror(); err != nil {
+			return nil, err
+		}
+	}
+
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+
+	if _, err := g.run("fetch"); err != nil {
+		return nil, err
+	}
+	args := []string{"log", "--format=%h %s", "--abbrev=8", fmt.Sprintf("HEAD..origin/%s", g.branch), "--"}
+	args = append(args, g.dirs...)
+	out, err := g.run(args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return strings.Split(string(out), "\n"), nil
+}
+
 // Hash returns the git hash of HEAD in the repo in g.mount. Empty string is returned in case of an error.
 // The hash is always truncated to 8 hex digits.
 func (g *Git) Hash() string {
@@ -161,17 +270,172 @@ func (g *Git) Rollback(hash string) error {
 	return err
 }
 
-// Stash runs a git stash
-func (g *Git) Stash() error {
+// Track makes g track ref like Switch does, but without fetching or checking anything out: if ref is a branch on the
+// remote it's tracked as such, otherwise it's taken as the ref HEAD is detached at.
+func (g *Git) Track(ref string) {
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+
+	if _, err := g.run("rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+ref); err == nil {
+		g.branch, g.detached = ref, ""
+		return
+	}
+	g.detached = ref
+}
+
+// Ref returns the branch that is tracked, or the ref HEAD is detached at when Switch switched to something that
+// isn't a branch.
+func (g *Git) Ref() string {
+	if g.detached != "" {
+		return g.detached
+	}
+	return g.branch
+}
+
+// Switch switches the checkout to ref. If ref is a branch in upstream, it is tracked by Pull and Fetch from then on,
+// otherwise ref is resolved to a commit and HEAD is detached at it. Local changes are stashed first. It returns true
+// if HEAD changed.
+func (g *Git) Switch(ref string) (bool, error) {
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return false, fmt.Errorf("invalid ref %q", ref)
+	}
+	if err := g.Stash(); err != nil {
+		return false, err
+	}
+	if g.mirror != "" {
+		if err := g.updateMirror(); err != nil {
+			return false, err
+		}
+	}
+	before := g.Hash()
+
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+
+	if _, err := g.run("fetch"); err != nil {
+		return false, err
+	}
+	if _, err := g.run("rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+ref); err == nil {
+		if _, err := g.run("checkout", "--quiet", "-B", ref, "origin/"+ref); err != nil {
+			return false, err
+		}
+		g.branch, g.detached = ref, ""
+	} else {
+		hash, err := g.run("rev-parse", "--verify", "--quiet", ref+"^{commit}")
+		if err != nil || len(hash) == 0 {
+			return false, fmt.Errorf("unknown ref %q", ref)
+		}
+		if _, err := g.run("checkout", "--quiet", "--detach", string(hash)); err != nil {
+			return false, err
+		}
+		g.detached = ref
+	}
+	after, err := g.run("rev-parse", "HEAD")
+	if err != nil {
+		return false, err
+	}
+	return before == "" || !strings.HasPrefix(string(after), before), nil
+}
+
+// Resolve resolves ref, i.e. a (abbreviated) hash, a tag or "HEAD~1", to the full hash of the commit it points to.
+func (g *Git) Resolve(ref string) (string, error) {
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid ref %q", ref)
+	}
+
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+
+	out, err := g.run("rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil || len(out) == 0 {
+		return "", fmt.Errorf("unknown ref %q", ref)
+	}
+	return string(out), nil
+}
+
+// Status returns the paths in the dirs we are interested in that have local changes, including untracked files.
+// Changes to the mode of files are ignored, as these may be set on purpose.
+func (g *Git) Status() ([]string, error) {
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+
+	args := []string{"status", "--porcelain=v2", "--untracked-files=all", "--"}
+	args = append(args, g.dirs...)
+	out, err := g.run(args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	paths := []string{}
+	for _, l := range strings.Split(string(out), "\n") {
+		// the number of fields before the path depends on the type of change, see git-status(1).
+		n := 0
+		switch {
+		case strings.HasPrefix(l, "1 "):
+			n = 9
+		case strings.HasPrefix(l, "2 "):
+			n = 10
+		case strings.HasPrefix(l, "u "):
+			n = 11
+		case strings.HasPrefix(l, "? "):
+			n = 2
+		default:
+			continue
+		}
+		fields := strings.SplitN(l, " ", n)
+		if len(fields) != n {
+			continue
+		}
+		p, _, _ := strings.Cut(fields[n-1], "\t") // renames have <path> TAB <original path>
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// Reset throws away all local changes, including untracked files, in the dirs we are interested in.
+func (g *Git) Reset() error {
 	g.cwd = g.mount
 	defer func() { g.cwd = "" }()
 
-	_, err := g.run("stash")
+	if _, err := g.run("reset", "--hard", "--quiet"); err != nil {
+		return err
+	}
+	args := []string{"clean", "--force", "-d", "--quiet", "--"}
+	args = append(args, g.dirs...)
+	_, err := g.run(args...)
 	return err
 }
 
 func (g *Git) Repo() string { return g.mount }
 
+// CloneBare does a bare clone of g.branch into g.mount, without downloading the contents of any files. This is
+// enough to see which paths exist, see Type.
+func (g *Git) CloneBare() error {
+	g.cwd = ""
+	_, err := g.run("clone", "--bare", "--single-branch", "-b", g.branch, "--filter=blob:none", g.upstream, g.mount)
+	return err
+}
+
+// Type returns the type of the path p in HEAD: "tree" for directories and "blob" for files. If p doesn't exist the
+// empty string is returned.
+func (g *Git) Type(p string) (string, error) {
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+
+	out, err := g.run("ls-tree", "HEAD", "--", strings.TrimSuffix(p, "/"))
+	if err != nil {
+		return "", err
+	}
+	// <mode> SP <type> SP <object> TAB <file>
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 {
+		return "", nil
+	}
+	return fields[1], nil
+}
+
 // these methods below are only used in gitopperhdr.
 
 // OriginURL returns the value of git config --get remote.origin.url
@@ -2,6 +2,9 @@ package gitcmd
 
 import (
 	"encoding/hex"
+	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"go.science.ru.nl/log"
@@ -24,6 +27,14 @@ func TestHash(t *testing.T) {
 	}
 }
 
+func TestUnknownUser(t *testing.T) {
+	log.Discard()
+	g := New("", "", ".", "promtheus-does-not-exist", nil)
+	if hash := g.Hash(); hash != "" {
+		t.Fatalf("expected git not to run for an unknown user, got hash %q", hash)
+	}
+}
+
 func TestDiffStatOK(t *testing.T) {
 	g := New("", "", ".", "", []string{"my/stuff"})
 
@@ -69,3 +80,133 @@ Fast-forward
 		t.Fatal("Expected to find _no_ paths of interest, but got some")
 	}
 }
+
+func TestStatus(t *testing.T) {
+	log.Discard()
+	upstream := t.TempDir()
+	gitRun(t, upstream, "init", "-q", "-b", "main")
+	os.MkdirAll(path.Join(upstream, "prometheus"), 0755)
+	os.WriteFile(path.Join(upstream, "prometheus", "prometheus.yml"), []byte("v1"), 0644)
+	os.WriteFile(path.Join(upstream, "prometheus", "alerts.yml"), []byte("v1"), 0644)
+	gitRun(t, upstream, "add", "-A")
+	gitRun(t, upstream, "commit", "-q", "-m", "v1")
+
+	g := New(upstream, "main", path.Join(t.TempDir(), "prometheus"), "", []string{"prometheus"})
+	if err := g.Checkout(); err != nil {
+		t.Fatal(err)
+	}
+	if drift, err := g.Status(); err != nil || len(drift) != 0 {
+		t.Fatalf("expected no local changes, got %v: %v", drift, err)
+	}
+
+	os.WriteFile(path.Join(g.Repo(), "prometheus", "prometheus.yml"), []byte("edited"), 0644)
+	os.WriteFile(path.Join(g.Repo(), "prometheus", "new file.yml"), []byte("new"), 0644)
+	os.Chmod(path.Join(g.Repo(), "prometheus", "alerts.yml"), 0755)
+	drift, err := g.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(drift, ",") != "prometheus/prometheus.yml,prometheus/new file.yml" {
+		t.Errorf("expected local changes, got %q", drift)
+	}
+
+	if err := g.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if drift, err := g.Status(); err != nil || len(drift) != 0 {
+		t.Errorf("expected no local changes after reset, got %v: %v", drift, err)
+	}
+	// a mode set on purpose is kept by reset and pulls.
+	if info, _ := os.Stat(path.Join(g.Repo(), "prometheus", "alerts.yml")); info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode %o to be kept, got %o", 0755, info.Mode().Perm())
+	}
+}
+
+func TestResolve(t *testing.T) {
+	log.Discard()
+	upstream := t.TempDir()
+	gitRun(t, upstream, "init", "-q", "-b", "main")
+	os.WriteFile(path.Join(upstream, "prometheus.yml"), []byte("v1"), 0644)
+	gitRun(t, upstream, "add", "-A")
+	gitRun(t, upstream, "commit", "-q", "-m", "v1")
+	gitRun(t, upstream, "tag", "v1")
+	os.WriteFile(path.Join(upstream, "prometheus.yml"), []byte("v2"), 0644)
+	gitRun(t, upstream, "commit", "-q", "-a", "-m", "v2")
+
+	g := New(upstream, "main", path.Join(t.TempDir(), "prometheus"), "", []string{"prometheus.yml"})
+	if err := g.Checkout(); err != nil {
+		t.Fatal(err)
+	}
+	head, err := g.Resolve("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(head) != 40 || head[:8] != g.Hash() {
+		t.Errorf("expected full hash starting with %s, got %q", g.Hash(), head)
+	}
+	// odd length abbreviation
+	if hash, err := g.Resolve(head[:7]); err != nil || hash != head {
+		t.Errorf("expected %s for %s, got %q: %v", head, head[:7], hash, err)
+	}
+	prev, err := g.Resolve("HEAD~1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := g.Resolve("v1"); err != nil || hash != prev {
+		t.Errorf("expected tag v1 to resolve to %s, got %q: %v", prev, hash, err)
+	}
+	for _, ref := range []string{"HEAD~2", "nosuchtag", "--all", ""} {
+		if _, err := g.Resolve(ref); err == nil {
+			t.Errorf("expected error for %q", ref)
+		}
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	log.Discard()
+	upstream := t.TempDir()
+	gitRun(t, upstream, "init", "-q", "-b", "main")
+	os.WriteFile(path.Join(upstream, "prometheus.yml"), []byte("v1"), 0644)
+	gitRun(t, upstream, "add", "-A")
+	gitRun(t, upstream, "commit", "-q", "-m", "v1")
+
+	g := New(upstream, "main", path.Join(t.TempDir(), "prometheus"), "", []string{"prometheus.yml"})
+	if err := g.Checkout(); err != nil {
+		t.Fatal(err)
+	}
+	v1 := g.Hash()
+	gitRun(t, upstream, "checkout", "-q", "-b", "feature")
+	os.WriteFile(path.Join(upstream, "prometheus.yml"), []byte("feature"), 0644)
+	gitRun(t, upstream, "commit", "-q", "-a", "-m", "feature")
+	file := path.Join(g.Repo(), "prometheus.yml")
+
+	if changed, err := g.Switch("feature"); err != nil || !changed || g.Ref() != "feature" {
+		t.Fatalf("expected switch to feature, got %t, %q: %v", changed, g.Ref(), err)
+	}
+	if buf, _ := os.ReadFile(file); string(buf) != "feature" {
+		t.Errorf("expected %q, got %q", "feature", buf)
+	}
+	// the branch is tracked
+	os.WriteFile(path.Join(upstream, "prometheus.yml"), []byte("feature2"), 0644)
+	gitRun(t, upstream, "commit", "-q", "-a", "-m", "feature2")
+	if changed, err := g.Pull(); err != nil || !changed {
+		t.Fatalf("expected pull of feature, got %t: %v", changed, err)
+	}
+	if buf, _ := os.ReadFile(file); string(buf) != "feature2" {
+		t.Errorf("expected %q, got %q", "feature2", buf)
+	}
+
+	if changed, err := g.Switch(v1); err != nil || !changed || g.Ref() != v1 {
+		t.Fatalf("expected switch to %s, got %t, %q: %v", v1, changed, g.Ref(), err)
+	}
+	if changed, err := g.Pull(); err != nil || changed {
+		t.Errorf("expected no pull when detached, got %t: %v", changed, err)
+	}
+
+	if changed, err := g.Switch("main"); err != nil || changed || g.Ref() != "main" {
+		t.Fatalf("expected switch to main without changes, got %t, %q: %v", changed, g.Ref(), err)
+	}
+	if _, err := g.Switch("nosuchbranch"); err == nil {
+		t.Errorf("expected error for unknown ref")
+	}
+}
@@ -0,0 +1,88 @@
+package gitcmd
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MirrorAge is the age after which a mirror is fetched from upstream again. All pulls from a mirror within this time
+// share the same fetch.
+var MirrorAge = time.Minute
+
+type mirror struct {
+	sync.Mutex
+	fetched time.Time
+}
+
+var (
+	mirrorsMu sync.Mutex
+	mirrors   = map[string]*mirror{}
+)
+
+// SetMirror makes g use a bare mirror of upstream in the directory cache. The mirror is shared by all Gits using the
+// same upstream and cache: the repository in g.mount is cloned from the mirror and shares its objects, and all
+// fetches are done from the mirror. The mirror itself is fetched from upstream at most once every MirrorAge.
+func (g *Git) SetMirror(cache string) {
+	if cache == "" {
+		g.mirror = ""
+		return
+	}
+	sum := sha1.Sum([]byte(g.upstream))
+	name := path.Base(strings.TrimSuffix(g.upstream, ".git"))
+	g.mirror = path.Join(cache, fmt.Sprintf("%s-%s.git", name, hex.EncodeToString(sum[:4])))
+}
+
+// Mirror returns the directory of the mirror used, or the empty string if no mirror is used.
+func (g *Git) Mirror() string { return g.mirror }
+
+// FetchMirror makes the next use of the mirror fetch from upstream, even if it was fetched within MirrorAge. This is
+// used for on demand pulls, which should see what was just pushed.
+func (g *Git) FetchMirror() { g.fetch = true }
+
+// updateMirror clones the mirror when it doesn't exist yet, or fetches from upstream if the mirror hasn't been
+// fetched for MirrorAge, see FetchMirror. Git commands on the mirror are run as the current user.
+func (g *Git) updateMirror() error {
+	mirrorsMu.Lock()
+	m, ok := mirrors[g.mirror]
+	if !ok {
+		m = &mirror{}
+		mirrors[g.mirror] = m
+	}
+	mirrorsMu.Unlock()
+
+	m.Lock()
+	defer m.Unlock()
+
+	mg := &Git{upstream: g.upstream, key: g.key, knownHosts: g.knownHosts, tokenFile: g.tokenFile}
+	if _, err := os.Stat(path.Join(g.mirror, "HEAD")); err != nil {
+		if err := os.MkdirAll(path.Dir(g.mirror), 0755); err != nil {
+			return fmt.Errorf("failed to create directory %q: %s", path.Dir(g.mirror), err)
+		}
+		if _, err := mg.run("clone", "--mirror", g.upstream, g.mirror); err != nil {
+			return err
+		}
+		mg.cwd = g.mirror
+		// clones share the objects of the mirror, these may never be removed.
+		if _, err := mg.run("config", "gc.auto", "0"); err != nil {
+			return err
+		}
+		m.fetched = time.Now()
+		return nil
+	}
+	if !g.fetch && time.Since(m.fetched) < MirrorAge {
+		return nil
+	}
+	mg.cwd = g.mirror
+	if _, err := mg.run("fetch", "--prune", "origin"); err != nil {
+		return err
+	}
+	m.fetched = time.Now()
+	g.fetch = false
+	return nil
+}
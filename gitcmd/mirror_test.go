@@ -0,0 +1,73 @@
+package gitcmd
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+
+	"go.science.ru.nl/log"
+)
+
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.org"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %s: %s", args, err, out)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	log.Discard()
+	upstream := t.TempDir()
+	gitRun(t, upstream, "init", "-q", "-b", "main")
+	os.MkdirAll(path.Join(upstream, "prometheus"), 0755)
+	os.WriteFile(path.Join(upstream, "prometheus", "prometheus.yml"), []byte("v1"), 0644)
+	gitRun(t, upstream, "add", "-A")
+	gitRun(t, upstream, "commit", "-q", "-m", "v1")
+
+	cache := t.TempDir()
+	g1 := New(upstream, "main", path.Join(t.TempDir(), "prometheus"), "", []string{"prometheus"})
+	g1.SetMirror(cache)
+	g2 := New(upstream, "main", path.Join(t.TempDir(), "grafana"), "", []string{"prometheus"})
+	g2.SetMirror(cache)
+	if g1.Mirror() != g2.Mirror() {
+		t.Fatalf("expected the same mirror, got %q and %q", g1.Mirror(), g2.Mirror())
+	}
+
+	for _, g := range []*Git{g1, g2} {
+		if err := g.Checkout(); err != nil {
+			t.Fatalf("expected to checkout, got: %s", err)
+		}
+		if _, err := os.Stat(path.Join(g.Repo(), ".git", "objects", "info", "alternates")); err != nil {
+			t.Errorf("expected %q to share objects with the mirror: %s", g.Repo(), err)
+		}
+	}
+
+	os.WriteFile(path.Join(upstream, "prometheus", "prometheus.yml"), []byte("v2"), 0644)
+	gitRun(t, upstream, "commit", "-q", "-a", "-m", "v2")
+
+	// the mirror was just fetched, so no new changes are seen
+	if changed, err := g1.Pull(); err != nil || changed {
+		t.Errorf("expected no changes, got %t: %v", changed, err)
+	}
+	// an on demand pull fetches the mirror anyway, the other clone shares that fetch.
+	g1.FetchMirror()
+	if changed, err := g1.Pull(); err != nil || !changed {
+		t.Errorf("expected changes, got %t: %v", changed, err)
+	}
+	if changed, err := g2.Pull(); err != nil || !changed {
+		t.Errorf("expected changes, got %t: %v", changed, err)
+	}
+
+	os.WriteFile(path.Join(upstream, "prometheus", "prometheus.yml"), []byte("v3"), 0644)
+	gitRun(t, upstream, "commit", "-q", "-a", "-m", "v3")
+	defer func(age time.Duration) { MirrorAge = age }(MirrorAge)
+	MirrorAge = 0
+	if changed, err := g1.Pull(); err != nil || !changed {
+		t.Errorf("expected changes, got %t: %v", changed, err)
+	}
+}
@@ -0,0 +1,166 @@
+package gitcmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// stashPrefix is the start of the message of the stashes we create.
+const stashPrefix = "gitopper"
+
+// Stash is a stash created by Stash.
+type Stash struct {
+	ID    string    // Hash of the stash commit, truncated to 8 hex digits.
+	Time  time.Time // When the stash was created.
+	Hash  string    // Hash of HEAD when the stash was created.
+	Files []string  // Files in the stash.
+}
+
+// SetKeepStashes sets the number of stashes that are kept, older stashes are dropped by Stash. If keep is zero or
+// negative all stashes are kept.
+func (g *Git) SetKeepStashes(keep int) { g.keep = keep }
+
+// Stash stashes the local changes, if there are any. Untracked files are stashed too, as Status reports them. The
+// stash is labelled with the current time and the hash of HEAD, and old stashes are dropped, see SetKeepStashes.
+func (g *Git) Stash() error {
+	hash := g.Hash()
+
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+
+	msg := fmt.Sprintf("%s %s %s", stashPrefix, time.Now().UTC().Format(time.RFC3339), hash)
+	if _, err := g.run("stash", "push", "--include-untracked", "--message", msg); err != nil {
+		return err
+	}
+	if g.keep <= 0 {
+		return nil
+	}
+	stashes, err := g.list()
+	if err != nil {
+		return err
+	}
+	// drop the oldest first, so the refs of the newer ones stay valid.
+	for i := len(stashes) - 1; i >= g.keep; i-- {
+		if _, err := g.run("stash", "drop", "--quiet", stashes[i].ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stashes returns the stashes created by Stash, newest first.
+func (g *Git) Stashes() ([]Stash, error) {
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+
+	stashes, err := g.list()
+	if err != nil {
+		return nil, err
+	}
+	s := make([]Stash, len(stashes))
+	for i := range stashes {
+		s[i] = stashes[i].Stash
+		out, err := g.run("stash", "show", "--include-untracked", "--name-only", stashes[i].ref)
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > 0 {
+			s[i].Files = strings.Split(string(out), "\n")
+		}
+	}
+	return s, nil
+}
+
+// RestoreStash applies the stash with id to the repo, the stash itself is kept.
+func (g *Git) RestoreStash(id string) error {
+	ref, err := g.stashRef(id)
+	if err != nil {
+		return err
+	}
+
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+	_, err = g.run("stash", "apply", "--quiet", ref)
+	return err
+}
+
+// StashPatch returns the changes in the stash with id as a patch.
+func (g *Git) StashPatch(id string) ([]byte, error) {
+	ref, err := g.stashRef(id)
+	if err != nil {
+		return nil, err
+	}
+
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+	out, err := g.run("stash", "show", "--include-untracked", "--patch", ref)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+type stash struct {
+	Stash
+	ref  string // i.e. stash@{0}, changes when stashes are added or dropped
+	hash string // full hash of the stash commit
+}
+
+// stashRef returns the ref of the stash with id, id may be abbreviated.
+func (g *Git) stashRef(id string) (string, error) {
+	g.cwd = g.mount
+	defer func() { g.cwd = "" }()
+
+	stashes, err := g.list()
+	if err != nil {
+		return "", err
+	}
+	ref := ""
+	for _, s := range stashes {
+		if !strings.HasPrefix(s.hash, id) {
+			continue
+		}
+		if ref != "" {
+			return "", fmt.Errorf("stash %q is ambiguous", id)
+		}
+		ref = s.ref
+	}
+	if ref == "" {
+		return "", fmt.Errorf("stash %q not found", id)
+	}
+	return ref, nil
+}
+
+// list returns the stashes created by Stash, newest first. The caller must set g.cwd.
+func (g *Git) list() ([]stash, error) {
+	out, err := g.run("stash", "list", "--format=%gd %H %s")
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	stashes := []stash{}
+	for _, l := range strings.Split(string(out), "\n") {
+		// <ref> SP <hash> SP On <branch>: gitopper <time> <hash>
+		fields := strings.Fields(l)
+		if len(fields) < 5 || len(fields[1]) < 8 {
+			continue
+		}
+		_, msg, ok := strings.Cut(l, ": ")
+		if !ok {
+			continue
+		}
+		label := strings.Fields(msg)
+		if len(label) != 3 || label[0] != stashPrefix {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, label[1])
+		if err != nil {
+			continue
+		}
+		stashes = append(stashes, stash{Stash: Stash{ID: fields[1][:8], Time: t, Hash: label[2]}, ref: fields[0], hash: fields[1]})
+	}
+	return stashes, nil
+}
@@ -0,0 +1,92 @@
+package gitcmd
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"go.science.ru.nl/log"
+)
+
+func TestStash(t *testing.T) {
+	log.Discard()
+	upstream := t.TempDir()
+	gitRun(t, upstream, "init", "-q", "-b", "main")
+	os.MkdirAll(path.Join(upstream, "prometheus"), 0755)
+	os.WriteFile(path.Join(upstream, "prometheus", "prometheus.yml"), []byte("v1"), 0644)
+	gitRun(t, upstream, "add", "-A")
+	gitRun(t, upstream, "commit", "-q", "-m", "v1")
+
+	g := New(upstream, "main", path.Join(t.TempDir(), "prometheus"), "", []string{"prometheus"})
+	g.SetKeepStashes(2)
+	if err := g.Checkout(); err != nil {
+		t.Fatal(err)
+	}
+	file := path.Join(g.Repo(), "prometheus", "prometheus.yml")
+
+	// no changes, no stash
+	if err := g.Stash(); err != nil {
+		t.Fatal(err)
+	}
+	// a stash not made by us, should be ignored
+	os.WriteFile(file, []byte("manual"), 0644)
+	gitRun(t, g.Repo(), "stash", "push", "-q", "-m", "manual")
+
+	for _, edit := range []string{"edit1", "edit2", "edit3"} {
+		os.WriteFile(file, []byte(edit), 0644)
+		if err := g.Stash(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stashes, err := g.Stashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stashes) != 2 {
+		t.Fatalf("expected 2 stashes, got %d", len(stashes))
+	}
+	if stashes[0].Hash != g.Hash() || stashes[0].Time.IsZero() {
+		t.Errorf("expected stash to be labelled with hash %s and time, got %s and %s", g.Hash(), stashes[0].Hash, stashes[0].Time)
+	}
+	if strings.Join(stashes[0].Files, ",") != "prometheus/prometheus.yml" {
+		t.Errorf("expected stash with prometheus/prometheus.yml, got %v", stashes[0].Files)
+	}
+	out, _ := exec.Command("git", "-C", g.Repo(), "stash", "list").Output()
+	if !strings.Contains(string(out), ": manual") {
+		t.Errorf("expected stash not made by us to be kept, got %q", out)
+	}
+
+	patch, err := g.StashPatch(stashes[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(patch), "+edit2") {
+		t.Errorf("expected patch with edit2, got %q", patch)
+	}
+
+	if err := g.RestoreStash(stashes[0].ID[:5]); err != nil { // abbreviated
+		t.Fatal(err)
+	}
+	if buf, _ := os.ReadFile(file); string(buf) != "edit3" {
+		t.Errorf("expected restored stash with %q, got %q", "edit3", buf)
+	}
+	// untracked files are stashed as well
+	untracked := path.Join(g.Repo(), "prometheus", "rules.yml")
+	os.WriteFile(untracked, []byte("rules"), 0644)
+	if err := g.Stash(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(untracked); err == nil {
+		t.Errorf("expected untracked file %q to be stashed", untracked)
+	}
+	if stashes, _ := g.Stashes(); len(stashes) == 0 || !strings.Contains(strings.Join(stashes[0].Files, ","), "prometheus/rules.yml") {
+		t.Errorf("expected stash with prometheus/rules.yml, got %v", stashes)
+	}
+
+	if err := g.RestoreStash("deadbeef"); err == nil {
+		t.Errorf("expected error for unknown stash")
+	}
+}
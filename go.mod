@@ -13,7 +13,10 @@ require (
 	golang.org/x/crypto v0.25.0
 )
 
-require github.com/phayes/freeport v0.0.0-20220201140144-74d24b5ae9f5
+require (
+	filippo.io/age v1.2.1
+	github.com/phayes/freeport v0.0.0-20220201140144-74d24b5ae9f5
+)
 
 require github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"go.science.ru.nl/log"
+)
+
+// maxHistory is the maximum number of events kept in the history of a service.
+const maxHistory = 100
+
+// Event is an entry in the history of a service: a state change or a package operation.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// persisted is the part of the state of a service that survives restarts, it is saved in statefile.
+type persisted struct {
+	Packages []string `json:"packages,omitempty"` // packages installed for the service
+	History  []Event  `json:"history,omitempty"`
+	Previous string   `json:"previous,omitempty"` // hash deployed before the current one
+	LastGood string   `json:"lastgood,omitempty"` // hash of the last successful deploy
+	Pin      *Pin     `json:"pin,omitempty"`
+}
+
+// statefile returns the file where the persisted state of s is kept, or the empty string if s has no mount.
+func (s *Service) statefile() string {
+	if s.Mount == "" {
+		return ""
+	}
+	return path.Join(s.Mount, ".gitopper", s.Service+".json")
+}
+
+// load loads the persisted state of s. A missing state file is not an error.
+func (s *Service) load() error {
+	file := s.statefile()
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p := persisted{}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("failed to parse %q: %s", file, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.installed = p.Packages
+	s.history = p.History
+	s.previous = p.Previous
+	s.lastGood = p.LastGood
+	s.pin = p.Pin
+	return nil
+}
+
+// save marks the persisted state of s as changed, the caller must hold s.mu. The state is written by flush, which
+// must be called after s.mu is released.
+func (s *Service) save() { s.dirty = true }
+
+// flush writes the persisted state of s if it has changed. The state is copied while holding s.mu, and written after
+// releasing it, so slow disks don't block readers of s.
+func (s *Service) flush() {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return
+	}
+	s.dirty = false
+	s.saved++
+	version := s.saved
+	p := persisted{
+		Packages: append([]string(nil), s.installed...),
+		History:  append([]Event(nil), s.history...),
+		Previous: s.previous,
+		LastGood: s.lastGood,
+	}
+	if s.pin != nil {
+		pin := *s.pin
+		p.Pin = &pin
+	}
+	s.mu.Unlock()
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if version < s.written { // a newer state is already written
+		return
+	}
+	s.written = version
+
+	file := s.statefile()
+	if file == "" {
+		return
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		log.Warningf("Service %q, error saving state: %s", s.Service, err)
+		return
+	}
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		log.Warningf("Service %q, error saving state: %s", s.Service, err)
+		return
+	}
+	// write and rename, so a crash never leaves a half written file.
+	if err := os.WriteFile(file+".tmp", data, 0644); err != nil {
+		log.Warningf("Service %q, error saving state: %s", s.Service, err)
+		return
+	}
+	if err := os.Rename(file+".tmp", file); err != nil {
+		log.Warningf("Service %q, error saving state: %s", s.Service, err)
+	}
+}
+
+// record adds an event to the history of s, the caller must hold s.mu.
+func (s *Service) record(format string, a ...interface{}) {
+	s.history = append(s.history, Event{Time: time.Now().UTC(), Message: fmt.Sprintf(format, a...)})
+	if len(s.history) > maxHistory {
+		s.history = s.history[len(s.history)-maxHistory:]
+	}
+	s.save()
+}
+
+// Record adds an event to the history of s.
+func (s *Service) Record(format string, a ...interface{}) {
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(format, a...)
+}
+
+// History returns the history of s, oldest event first.
+func (s *Service) History() []Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Event(nil), s.history...)
+}
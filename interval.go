@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+)
+
+// Duration is a time.Duration that can be read from the config as a string, i.e. "10m".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.Duration.String()), nil }
+
+// minInterval is the shortest interval between pulls that is accepted in the config.
+const minInterval = time.Second
+
+// maxBackoff is the maximum time between pulls when pulling keeps failing.
+const maxBackoff = time.Hour
+
+// backoff returns the time to wait until the next pull after failures consecutive failures: d is doubled for each
+// failure, up to maxBackoff. If d itself is larger than maxBackoff, d is returned.
+func backoff(d time.Duration, failures int) time.Duration {
+	if d >= maxBackoff {
+		return d
+	}
+	for i := 0; i < failures; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return d
+}
+
+// Next returns the time of the next scheduled pull.
+func (s *Service) Next() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.next
+}
+
+// SetNext sets the time of the next scheduled pull.
+func (s *Service) SetNext(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next = t
+
+	metricServiceNext.WithLabelValues(s.Service).Set(float64(t.Unix()))
+}
+
+// nextPull returns the time of the next scheduled pull as shown to users, or the empty string when none is scheduled.
+func (s *Service) nextPull() string {
+	next := s.Next()
+	if next.IsZero() {
+		return ""
+	}
+	return next.Format(time.RFC1123)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, test := range []struct {
+		d        time.Duration
+		failures int
+		expect   time.Duration
+	}{
+		{5 * time.Minute, 0, 5 * time.Minute},
+		{5 * time.Minute, 1, 10 * time.Minute},
+		{5 * time.Minute, 3, 40 * time.Minute},
+		{5 * time.Minute, 4, maxBackoff},
+		{5 * time.Minute, 100, maxBackoff},
+		{2 * time.Hour, 2, 2 * time.Hour},
+	} {
+		if got := backoff(test.d, test.failures); got != test.expect {
+			t.Errorf("expected backoff of %s after %d failures to be %s, got %s", test.d, test.failures, test.expect, got)
+		}
+	}
+}
+
+func TestInterval(t *testing.T) {
+	const conf = `
+[global]
+upstream = "https://github.com/miekg/gitopper-config"
+mount = "/tmp"
+interval = "10m"
+
+[[services]]
+machine = "localhost"
+service = "prometheus"
+
+[[services]]
+machine = "localhost"
+service = "grafana"
+interval = "1h"
+`
+	c, err := parseConfig([]byte(conf))
+	if err != nil {
+		t.Fatalf("expected to parse config, but got: %s", err)
+	}
+	for i, expect := range []time.Duration{10 * time.Minute, time.Hour} {
+		s := c.Services[i].config()
+		s.defaults(c.Global)
+		if s.Interval.Duration != expect {
+			t.Errorf("expected interval of %q to be %s, got %s", s.Service, expect, s.Interval)
+		}
+	}
+
+	if _, err := parseConfig([]byte("[global]\ninterval = \"10 minutes\"\n")); err == nil {
+		t.Errorf("expected error for invalid interval, got none")
+	}
+
+	c.Services[1].Interval = Duration{time.Nanosecond}
+	found := false
+	for _, p := range c.problems(false) {
+		if strings.Contains(p.Message, "interval 1ns is shorter") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected problem for too short interval, got %v", c.problems(false))
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for _, d := range []time.Duration{0, time.Nanosecond, time.Minute} {
+		if j := jitter(d); j < d || j > d+d/2 {
+			t.Errorf("expected jitter of %s to be in [%s, %s], got %s", d, d, d+d/2, j)
+		}
+	}
+}
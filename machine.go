@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/miekg/gitopper/osutil"
+)
+
+// hostLabels returns the labels of this host: labels, as given with --labels, and the labels from os-release r: "os"
+// (ID), "os_version" (VERSION_ID) and "os_codename" (VERSION_CODENAME). Labels in labels take precedence.
+func hostLabels(labels map[string]string, r osutil.Release) map[string]string {
+	l := map[string]string{}
+	for k, v := range map[string]string{"os": r.ID, "os_version": r.VersionID, "os_codename": r.VersionCodename} {
+		if v != "" {
+			l[k] = v
+		}
+	}
+	for k, v := range labels {
+		l[k] = v
+	}
+	return l
+}
+
+// patterns returns the machine patterns of s: the machine and machines, with any groups expanded.
+func (c Config) patterns(s *Service) []string {
+	patterns := []string{}
+	if s.Machine != "" {
+		patterns = append(patterns, s.Machine)
+	}
+	for _, m := range s.Machines {
+		if !strings.HasPrefix(m, "@") {
+			patterns = append(patterns, m)
+			continue
+		}
+		patterns = append(patterns, c.Global.Groups[m[1:]]...)
+	}
+	return patterns
+}
+
+// forMe returns true if s should run on this host. One of hosts must match one of the machine patterns of s and the
+// labels of s must all be present in the labels of this host. When s only has labels, the labels need to match.
+func (c Config) forMe(s *Service, hosts []string) bool {
+	for k, v := range s.Labels {
+		if l, ok := c.labels[k]; !ok || l != v {
+			return false
+		}
+	}
+	patterns := c.patterns(s)
+	if len(patterns) == 0 {
+		return len(s.Labels) > 0
+	}
+	for _, p := range patterns {
+		for _, h := range hosts {
+			if ok, _ := path.Match(p, h); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkMachines returns an error if s has no way to select machines, uses an unknown group or has invalid glob
+// patterns.
+func (c Config) checkMachines(s *Service) error {
+	if s.Machine == "" && len(s.Machines) == 0 && len(s.Labels) == 0 {
+		return fmt.Errorf("has empty machine name")
+	}
+	for _, m := range s.Machines {
+		if !strings.HasPrefix(m, "@") {
+			continue
+		}
+		if _, ok := c.Global.Groups[m[1:]]; !ok {
+			return fmt.Errorf("unknown group %q", m)
+		}
+	}
+	for _, p := range c.patterns(s) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid machine pattern %q: %s", p, err)
+		}
+	}
+	return nil
+}
+
+// selectors returns the machine patterns of s, or the labels when s has no patterns. This is used to find duplicate
+// services.
+func (c Config) selectors(s *Service) []string {
+	if patterns := c.patterns(s); len(patterns) > 0 {
+		return patterns
+	}
+	labels := []string{}
+	for k, v := range s.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	return []string{strings.Join(labels, ",")}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/miekg/gitopper/osutil"
+)
+
+func TestForMe(t *testing.T) {
+	const conf = `
+[global]
+upstream = "https://github.com/miekg/gitopper-config"
+mount = "/tmp"
+keys = [ { path = "keys/miek.pub" } ]
+groups = { frontend = [ "web*", "lb1" ] }
+
+[[services]]
+machines = [ "db*" ]
+service = "postgres"
+
+[[services]]
+machines = [ "@frontend" ]
+service = "caddy"
+
+[[services]]
+machine = "web1"
+labels = { env = "prod" }
+service = "prometheus"
+
+[[services]]
+labels = { env = "test" }
+service = "grafana"
+`
+	c, err := parseConfig([]byte(conf))
+	if err != nil {
+		t.Fatalf("expected to parse config, but got: %s", err)
+	}
+	if err := c.Valid(); err != nil {
+		t.Fatalf("expected config to be valid, but got: %s", err)
+	}
+	c.labels = map[string]string{"env": "prod"}
+
+	for _, test := range []struct {
+		host     string
+		services []string
+	}{
+		{"db2", []string{"postgres"}},
+		{"lb1", []string{"caddy"}},
+		{"web1", []string{"caddy", "prometheus"}},
+		{"lb2", nil},
+	} {
+		services := []string{}
+		for _, s := range c.Services {
+			if c.forMe(s, []string{test.host}) {
+				services = append(services, s.Service)
+			}
+		}
+		if len(services) != len(test.services) {
+			t.Errorf("expected services %v for %q, got %v", test.services, test.host, services)
+			continue
+		}
+		for i := range services {
+			if services[i] != test.services[i] {
+				t.Errorf("expected services %v for %q, got %v", test.services, test.host, services)
+			}
+		}
+	}
+
+	c.labels = map[string]string{"env": "test"}
+	if !c.forMe(c.Services[3], []string{"anyhost"}) {
+		t.Errorf("expected service %q to be selected by labels", c.Services[3].Service)
+	}
+}
+
+func TestCheckMachines(t *testing.T) {
+	c := Config{Global: Global{Groups: map[string][]string{"frontend": {"web*"}}}}
+	for _, s := range []*Service{
+		{Service: "caddy"},
+		{Service: "caddy", Machines: []string{"@backend"}},
+		{Service: "caddy", Machines: []string{"web[1"}},
+	} {
+		if err := c.checkMachines(s); err == nil {
+			t.Errorf("expected error for machines %v, got none", s.Machines)
+		}
+	}
+
+	c.Keys = []*Key{{Path: "keys/miek.pub"}}
+	c.Service = &Service{Upstream: "https://github.com/miekg/gitopper-config", Mount: "/tmp"}
+	c.Services = []*Service{{Service: "caddy", Machines: []string{"@frontend"}}, {Service: "caddy", Machines: []string{"web*"}}}
+	if problems := c.Check(); len(problems) != 1 {
+		t.Errorf("expected a duplicate service problem, got: %v", problems)
+	}
+}
+
+func TestHostLabels(t *testing.T) {
+	r := osutil.Release{ID: "debian", VersionID: "12", VersionCodename: "bookworm"}
+	labels := hostLabels(map[string]string{"env": "prod", "os_codename": "trixie"}, r)
+	expect := map[string]string{"env": "prod", "os": "debian", "os_version": "12", "os_codename": "trixie"}
+	if !reflect.DeepEqual(labels, expect) {
+		t.Errorf("expected labels %v, got %v", expect, labels)
+	}
+}
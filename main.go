@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -13,11 +15,14 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/gliderlabs/ssh"
+	"github.com/miekg/gitopper/gitcmd"
 	"github.com/miekg/gitopper/ospkg"
 	"github.com/miekg/gitopper/osutil"
+	"github.com/miekg/gitopper/proto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	flag "github.com/spf13/pflag"
 	"go.science.ru.nl/log"
@@ -26,12 +31,17 @@ import (
 type ExecContext struct {
 	// Configuration
 	Hosts        []string
+	Labels       map[string]string
 	ConfigSource string
 	SAddr        string
 	MAddr        string
 	Debug        bool
 	Restart      bool
 	Root         bool
+	Rootless     bool
+	Once         bool
+	DryRun       bool
+	JSON         bool
 	Duration     time.Duration
 	Upstream     string
 	Dir          string
@@ -49,12 +59,17 @@ func (exec *ExecContext) RegisterFlags(fs *flag.FlagSet) {
 	}
 	fs.SortFlags = false
 	fs.StringSliceVarP(&exec.Hosts, "hosts", "h", []string{osutil.Hostname()}, "hosts (comma separated) to impersonate, hostname is always added")
+	fs.StringToStringVarP(&exec.Labels, "labels", "l", nil, "labels (comma separated key=value pairs) of this host, to select services")
 	fs.StringVarP(&exec.ConfigSource, "config", "c", "", "config file to read")
 	fs.StringVarP(&exec.SAddr, "ssh", "s", ":2222", "ssh address to listen on")
 	fs.StringVarP(&exec.MAddr, "metric", "m", ":9222", "http metrics address to listen on")
 	fs.BoolVarP(&exec.Debug, "debug", "d", false, "enable debug logging")
 	fs.BoolVarP(&exec.Restart, "restart", "r", false, "send SIGHUP when config changes")
 	fs.BoolVarP(&exec.Root, "root", "o", true, "require root permission, setting to false can aid in debugging")
+	fs.BoolVar(&exec.Rootless, "rootless", false, "run without root, copy instead of bind mount and use systemd user units")
+	fs.BoolVar(&exec.Once, "once", false, "update all services once, print a summary and exit")
+	fs.BoolVar(&exec.DryRun, "dry-run", false, "show what would be done for all services and exit")
+	fs.BoolVar(&exec.JSON, "json", false, "output --dry-run and --once results as JSON")
 	fs.DurationVarP(&exec.Duration, "duration", "t", 5*time.Minute, "default duration between pulls")
 
 	// bootstrap flags
@@ -69,6 +84,7 @@ var (
 	ErrNotRoot  = errors.New("not root")
 	ErrNoConfig = errors.New("-c flag is mandatory")
 	ErrHUP      = errors.New("hangup requested")
+	ErrBroken   = errors.New("one or more services are broken")
 )
 
 type RepoPullError struct {
@@ -155,7 +171,7 @@ func serveSSH(exec *ExecContext, controllerWG, workerWG *sync.WaitGroup, allowed
 }
 
 func run(exec *ExecContext) error {
-	if os.Geteuid() != 0 && exec.Root {
+	if os.Geteuid() != 0 && exec.Root && !exec.Rootless {
 		return ErrNotRoot
 	}
 
@@ -171,12 +187,18 @@ func run(exec *ExecContext) error {
 	self := selfService(exec.Upstream, exec.Branch, exec.Mount, exec.Dir)
 	if self != nil {
 		log.Infof("Bootstrapping from repo %q and adding service %q for %q", exec.Upstream, self.Service, self.Machine)
+		if exec.Rootless {
+			self.setRootless() // can't fail, self doesn't have bind mounts
+		}
 		gc := self.newGitCmd()
+		if exec.DryRun && !gc.IsCheckedOut() {
+			return fmt.Errorf("can't bootstrap from repo %q in dry run mode, it's not checked out", self.Upstream)
+		}
 		err := gc.Checkout()
 		if err != nil {
 			return &RepoPullError{self.Machine, self.Upstream, err}
 		}
-		if exec.Pull {
+		if exec.Pull && !exec.DryRun {
 			if _, err := gc.Pull(); err != nil {
 				// don't exit here, we have a repo, maybe it's good enough, we can always pull later
 				log.Warningf("Bootstrapping service %q, error pulling repo %q: %s, continuing", self.Service, self.Upstream, err)
@@ -186,28 +208,26 @@ func run(exec *ExecContext) error {
 		log.Infof("Setting config to %s", exec.ConfigSource)
 	}
 
-	doc, err := os.ReadFile(exec.ConfigSource)
+	c, err := readConfig(exec.ConfigSource)
 	if err != nil {
 		return fmt.Errorf("reading config: %v", err)
 	}
-	c, err := parseConfig(doc)
-	if err != nil {
-		return fmt.Errorf("parsing config: %v", err)
-	}
 
 	if err := c.Valid(); err != nil {
 		return fmt.Errorf("validating config: %v", err)
 	}
+	release, err := osutil.OSRelease()
+	if err != nil {
+		log.Warningf("Failed to read os-release: %s", err)
+	}
+	c.labels = hostLabels(exec.Labels, release)
 
 	if self != nil {
 		c.Services = append(c.Services, self)
 	}
 
 	for _, k := range c.Global.Keys {
-		if !path.IsAbs(k.Path) && self != nil { // bootstrapping
-			newpath := path.Join(path.Join(path.Join(self.Mount, self.Service), exec.Dir), k.Path)
-			k.Path = newpath
-		}
+		k.Path = k.resolve(exec.ConfigSource)
 
 		log.Infof("Reading public key %q", k.Path)
 		data, err := ioutil.ReadFile(k.Path)
@@ -221,6 +241,10 @@ func run(exec *ExecContext) error {
 		k.PublicKey = a
 	}
 
+	if exec.DryRun {
+		return dryRun(os.Stdout, c, exec)
+	}
+
 	ctx, cancel := context.WithCancel(context.TODO())
 	defer cancel()
 
@@ -239,11 +263,14 @@ func run(exec *ExecContext) error {
 		}
 	}()
 
+	gitcmd.MirrorAge = mirrorAge(c, exec)
+
 	pkg := ospkg.New()
 	servCnt := 0
+	services := []*Service{}
 	hostServices := map[string]struct{}{} // we can't have duplicate service name on a single machine.
 	for _, serv := range c.Services {
-		if !serv.forMe(exec.Hosts) {
+		if !c.forMe(serv, exec.Hosts) {
 			continue
 		}
 		if _, ok := hostServices[serv.Service]; ok {
@@ -253,12 +280,37 @@ func run(exec *ExecContext) error {
 
 		servCnt++
 		s := serv.merge(c.Global)
+		services = append(services, s)
 		log.Infof("Service %q with upstream %q", s.Service, s.Upstream)
+		// before anything sets the state, as that saves it.
+		if err := s.load(); err != nil {
+			log.Warningf("Service %q, error loading state: %s", s.Service, err)
+		}
+		if exec.Rootless {
+			if err := s.setRootless(); err != nil {
+				log.Warningf("Service %q, error running rootless: %s", s.Service, err)
+				s.SetState(StateBroken, fmt.Sprintf("error running rootless: %s", err))
+				continue
+			}
+		}
 		gc := s.newGitCmd()
 
-		if s.Package != "" {
-			if err := pkg.Install(s.Package); err != nil {
-				log.Fatalf("Service %q, error installing package %q: %s", s.Service, s.Package, err)
+		if exec.Rootless {
+			for _, p := range s.packages() {
+				log.Warningf("Service %q, not installing package %q, because we are rootless", s.Service, p)
+			}
+		} else {
+			s.pkg = pkg
+			if err := s.reconcile(); err != nil {
+				log.Warningf("Service %q, error reconciling packages: %s", s.Service, err)
+				s.SetState(StateBroken, fmt.Sprintf("error %s", err))
+				continue
+			}
+			// after installing packages, as these may create the user.
+			if _, _, err := osutil.User(s.User, s.Group); err != nil {
+				log.Warningf("Service %q, error resolving user: %s", s.Service, err)
+				s.SetState(StateBroken, fmt.Sprintf("error resolving user: %s", err))
+				continue
 			}
 		}
 
@@ -269,14 +321,37 @@ func run(exec *ExecContext) error {
 			s.SetState(StateDiff, fmt.Sprintf("error pulling %q: %s", s.Upstream, err))
 			continue
 		}
+		// a pin survives restarts, so deploy what we're pinned to. On error the tracking routine tries again.
+		if _, err := s.checkout(gc); err != nil {
+			log.Warningf("Service %q, error checking out %q in repo %q: %s", s.Service, s.ref(), s.Upstream, err)
+		}
 
 		log.Infof("Service %q, repository in %q with %q", s.Service, gc.Repo(), gc.Hash())
 
-		// all succesfully done, do the bind mounts and start our puller
-		mounts, err := s.bindmount()
+		perms, err := s.perms()
 		if err != nil {
-			log.Warningf("Service %q, error setting up bind mounts for %q: %s", s.Service, s.Upstream, err)
-			s.SetState(StateBroken, fmt.Sprintf("error setting up bind mounts repo %q: %s", s.Upstream, err))
+			log.Warningf("Service %q, error setting permissions for %q: %s", s.Service, s.Upstream, err)
+			s.SetState(StateBroken, fmt.Sprintf("error setting permissions repo %q: %s", s.Upstream, err))
+			continue
+		}
+
+		if err := s.render(); err != nil {
+			log.Warningf("Service %q, error rendering templates for %q: %s", s.Service, s.Upstream, err)
+			s.SetState(StateBroken, fmt.Sprintf("error rendering templates repo %q: %s", s.Upstream, err))
+			continue
+		}
+
+		if err := s.decrypt(); err != nil {
+			log.Warningf("Service %q, error decrypting secrets for %q: %s", s.Service, s.Upstream, err)
+			s.SetState(StateBroken, fmt.Sprintf("error decrypting secrets repo %q: %s", s.Upstream, err))
+			continue
+		}
+
+		// all succesfully done, do the bind mounts (or copies) and start our puller
+		mounts, err := s.deploy()
+		if err != nil {
+			log.Warningf("Service %q, error deploying files for %q: %s", s.Service, s.Upstream, err)
+			s.SetState(StateBroken, fmt.Sprintf("error deploying files repo %q: %s", s.Upstream, err))
 			continue
 		}
 		if strings.Contains(s.Service, "@") {
@@ -284,34 +359,53 @@ func run(exec *ExecContext) error {
 				log.Fatalf("Service %q, error enabling instance template: %s", s.Service, err)
 			}
 		}
-		// Restart any services as they see new files in their bindmounts. Do this here, because we can't be
+		mounts += perms
+		// Restart any services as they see new files in their bindmounts (or copies). Do this here, because we can't be
 		// sure there is an update to a newer commit that would also kick off a restart.
 		if mounts > 0 {
 			if rerr := s.reload(); rerr != nil {
-				log.Warningf("Service %q, error running systemctl daemon-reload: %s", s.Service, rerr)
-				s.SetState(StateBroken, fmt.Sprintf("error running systemctl daemon-reload %q: %s", s.Upstream, rerr))
+				log.Warningf("Service %q, error reloading service manager: %s", s.Service, rerr)
+				s.SetState(StateBroken, fmt.Sprintf("error reloading service manager %q: %s", s.Upstream, rerr))
 			} else if err := s.start(); err != nil {
-				log.Warningf("Service %q, error running systemctl start: %s", s.Service, err)
-				s.SetState(StateBroken, fmt.Sprintf("error running systemctl start %q: %s", s.Upstream, err))
+				log.Warningf("Service %q, error starting service: %s", s.Service, err)
+				s.SetState(StateBroken, fmt.Sprintf("error starting service %q: %s", s.Upstream, err))
 				// no continue; maybe git pull will make this work later
 			} else {
+				s.good(gc.Hash())
 				s.SetState(StateOK, "")
 			}
 		} else {
+			s.good(gc.Hash())
 			s.SetState(StateOK, "")
 		}
 
+		if exec.Once {
+			s.update(gc, false)
+			s.SetHash(gc.Hash())
+			continue
+		}
+
 		workerWG.Add(1)
 		go func() {
 			defer workerWG.Done()
 			s.trackUpstream(ctx, exec.Duration)
 		}()
+		if s.pkg != nil && len(s.packages()) > 0 {
+			workerWG.Add(1)
+			go func() {
+				defer workerWG.Done()
+				s.trackUpgrades(ctx)
+			}()
+		}
 	}
 
 	if servCnt == 0 {
 		log.Warningf("No services found for machine: %v, exiting", exec.Hosts)
 		return nil
 	}
+	if exec.Once {
+		return summary(os.Stdout, services, exec.JSON)
+	}
 	sshHandler := newRouter(c, exec.Hosts)
 	if err := serveSSH(exec, &controllerWG, &workerWG, c.Global.Keys, sshHandler); err != nil {
 		return err
@@ -352,6 +446,84 @@ func run(exec *ExecContext) error {
 	return nil
 }
 
+// summary writes the hash and state of each service to w, as JSON if js is true. If any of the services is broken
+// or has a diff with upstream or local changes that block pulling ErrBroken is returned.
+func summary(w io.Writer, services []*Service, js bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tHASH\tSTATE\tINFO")
+	ls := proto.ListServices{ListServices: []proto.ListService{}}
+	var err error
+	for _, s := range services {
+		state, info := s.State()
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Service, s.Hash(), state, info)
+		ls.ListServices = append(ls.ListServices, proto.ListService{Service: s.Service, Hash: s.Hash(), State: state.String(), StateInfo: info})
+		if state == StateBroken || state == StateDiff || state == StateDrift {
+			err = ErrBroken
+		}
+	}
+	if !js {
+		tw.Flush()
+		return err
+	}
+	data, jerr := json.MarshalIndent(ls, "", "  ")
+	if jerr != nil {
+		return jerr
+	}
+	fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// mirrorAge returns the age after which mirrors are fetched again: half of the shortest interval between pulls of the
+// services for us in c, so no service pulls data that is older than its interval.
+func mirrorAge(c Config, exec *ExecContext) time.Duration {
+	age := exec.Duration
+	for _, serv := range c.Services {
+		if !c.forMe(serv, exec.Hosts) {
+			continue
+		}
+		s := serv.config()
+		s.defaults(c.Global)
+		if s.Interval.Duration > 0 && s.Interval.Duration < age {
+			age = s.Interval.Duration
+		}
+	}
+	return age / 2
+}
+
+// dryRun writes the plans for all services for us in c to w.
+func dryRun(w io.Writer, c Config, exec *ExecContext) error {
+	plans := []Plan{}
+	pkg := ospkg.New()
+	hostServices := map[string]struct{}{}
+	for _, serv := range c.Services {
+		if !c.forMe(serv, exec.Hosts) {
+			continue
+		}
+		if _, ok := hostServices[serv.Service]; ok {
+			return fmt.Errorf("Service %q has a duplicate on these machines %v", serv.Service, exec.Hosts)
+		}
+		hostServices[serv.Service] = struct{}{}
+
+		s := serv.merge(c.Global)
+		if err := s.load(); err != nil {
+			log.Warningf("Service %q, error loading state: %s", s.Service, err)
+		}
+		if exec.Rootless {
+			if err := s.setRootless(); err != nil {
+				plans = append(plans, Plan{Service: s.Service, Upstream: s.Upstream, Error: fmt.Sprintf("error running rootless: %s", err)})
+				continue
+			}
+		} else {
+			s.pkg = pkg
+		}
+		plans = append(plans, s.plan(exec.Rootless))
+	}
+	if len(plans) == 0 {
+		log.Warningf("No services found for machine: %v", exec.Hosts)
+	}
+	return writePlans(w, plans, exec.JSON)
+}
+
 func main() {
 	exec := ExecContext{HTTPMux: http.NewServeMux()}
 	exec.RegisterFlags(nil)
@@ -373,6 +545,22 @@ func main() {
 			f.Value.Set(osutil.Hostname())
 		}
 	})
+	switch flag.Arg(0) {
+	case "check":
+		if exec.ConfigSource == "" {
+			log.Fatal(ErrNoConfig)
+		}
+		if err := check(os.Stdout, exec.ConfigSource, exec.JSON); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "encrypt":
+		if err := encrypt(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	err := run(&exec)
 	switch {
 	case err == nil:
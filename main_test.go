@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -124,3 +126,36 @@ func TestServeMonitoring(t *testing.T) {
 	workerWG.Done()
 	controllerWG.Wait()
 }
+
+func TestSummary(t *testing.T) {
+	ok := &Service{Service: "prometheus"}
+	ok.SetState(StateOK, "")
+	broken := &Service{Service: "grafana"}
+	broken.SetState(StateBroken, "error deploying files")
+
+	buf := &bytes.Buffer{}
+	if err := summary(buf, []*Service{ok}, false); err != nil {
+		t.Errorf("summary(buf, ok) = %v, want %v", err, error(nil))
+	}
+	if err := summary(buf, []*Service{ok, broken}, false); !errors.Is(err, ErrBroken) {
+		t.Errorf("summary(buf, ok, broken) = %v, want %v", err, ErrBroken)
+	}
+	if !strings.Contains(buf.String(), "error deploying files") {
+		t.Errorf("expected summary to contain the info of broken services, got %q", buf.String())
+	}
+}
+
+func TestMirrorAge(t *testing.T) {
+	c := Config{
+		Global: Global{Service: &Service{Interval: Duration{10 * time.Minute}}},
+		Services: []*Service{
+			{Machine: "localhost", Service: "prometheus"},
+			{Machine: "localhost", Service: "grafana", Interval: Duration{time.Minute}},
+			{Machine: "otherhost", Service: "caddy", Interval: Duration{time.Second}},
+		},
+	}
+	exec := &ExecContext{Hosts: []string{"localhost"}, Duration: 5 * time.Minute}
+	if age := mirrorAge(c, exec); age != 30*time.Second {
+		t.Errorf("expected mirror age %s, got %s", 30*time.Second, age)
+	}
+}
@@ -21,4 +21,25 @@ var (
 		Name:      "change_time_seconds",
 		Help:      "Timestamp for last state change for this service.",
 	}, []string{"service"})
+
+	metricServiceNext = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gitopper",
+		Subsystem: "service",
+		Name:      "next_pull_time_seconds",
+		Help:      "Timestamp of the next scheduled pull for this service.",
+	}, []string{"service"})
+
+	metricServiceDrift = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gitopper",
+		Subsystem: "service",
+		Name:      "drift_files",
+		Help:      "Number of files with local changes in the git repo of this service.",
+	}, []string{"service"})
+
+	metricServiceUpgrades = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gitopper",
+		Subsystem: "service",
+		Name:      "package_upgrades",
+		Help:      "Number of packages of this service with a pending upgrade.",
+	}, []string{"service"})
 )
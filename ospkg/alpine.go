@@ -0,0 +1,65 @@
+package ospkg
+
+import "strings"
+
+// AlpineInstaller installs packages on Alpine Linux. A package installed with a version constraint is pinned to that
+// version by apk, so Hold doesn't need to do anything.
+type AlpineInstaller struct{}
+
+var _ Installer = (*AlpineInstaller)(nil)
+
+const apkCommand = "/sbin/apk"
+
+func (p *AlpineInstaller) Install(pkg string) error {
+	arg, err := apkPackage(pkg)
+	if err != nil {
+		return err
+	}
+	return install(pkg, nil, apkCommand, "add", "--quiet", "--no-progress", arg)
+}
+
+// apkPackage returns pkg in apk's syntax, a version prefix glob is translated to a fuzzy match, i.e.
+// "prometheus=2.45.*" becomes "prometheus~2.45".
+func apkPackage(pkg string) (string, error) {
+	name, version := Split(pkg)
+	switch {
+	case version == "":
+		return name, nil
+	case !isGlob(version):
+		return name + "=" + version, nil
+	}
+	prefix, ok := globPrefix(version)
+	if !ok {
+		return "", errVersion(pkg, "apk")
+	}
+	return name + "~" + prefix, nil
+}
+
+func (p *AlpineInstaller) Installed(pkg string) (string, bool) {
+	// <name>-<version>
+	out, ok := query(apkCommand, "info", "--installed", "--verbose", pkg)
+	if !ok || !strings.HasPrefix(out, pkg+"-") {
+		return "", false
+	}
+	return strings.TrimPrefix(out, pkg+"-"), true
+}
+
+func (p *AlpineInstaller) Hold(pkg string) error { return nil }
+
+func (p *AlpineInstaller) Remove(pkg string) error {
+	return remove(pkg, nil, apkCommand, "del", "--quiet", "--no-progress", pkg)
+}
+
+func (p *AlpineInstaller) Upgradable(pkg string) bool {
+	// <name>-<version> < <newer version>
+	out, ok := query(apkCommand, "version", "--limit", "<", pkg)
+	if !ok {
+		return false
+	}
+	for _, l := range strings.Split(out, "\n") {
+		if strings.HasPrefix(l, pkg+"-") && strings.Contains(l, " < ") {
+			return true
+		}
+	}
+	return false
+}
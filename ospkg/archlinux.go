@@ -1,12 +1,10 @@
 package ospkg
 
-import (
-	"os/exec"
+import "strings"
 
-	"go.science.ru.nl/log"
-)
-
-// ArchLinuxInstaller installs packages on Arch Linux.
+// ArchLinuxInstaller installs packages on Arch Linux. Pacman can't install a specific version of a package, so the
+// version constraint is only checked after installation. Holding packages isn't supported, use IgnorePkg in
+// pacman.conf for that.
 type ArchLinuxInstaller struct{}
 
 var _ Installer = (*ArchLinuxInstaller)(nil)
@@ -14,12 +12,25 @@ var _ Installer = (*ArchLinuxInstaller)(nil)
 const pacmanCommand = "/usr/bin/pacman"
 
 func (p *ArchLinuxInstaller) Install(pkg string) error {
-	installCmd := exec.Command(pacmanCommand, "-S", "--noconfirm", pkg)
-	out, err := installCmd.CombinedOutput()
-	if err != nil {
-		log.Warningf("Install failed: %s", out)
-	} else {
-		log.Infof("Already installed or re-installed %q", pkg)
-	}
-	return err
+	name, _ := Split(pkg)
+	return install(pkg, nil, pacmanCommand, "-S", "--noconfirm", name)
+}
+
+func (p *ArchLinuxInstaller) Installed(pkg string) (string, bool) {
+	// <name> SP <version>
+	out, ok := query(pacmanCommand, "-Q", pkg)
+	_, version, _ := strings.Cut(out, " ")
+	return version, ok
+}
+
+func (p *ArchLinuxInstaller) Hold(pkg string) error { return ErrHold }
+
+func (p *ArchLinuxInstaller) Remove(pkg string) error {
+	return remove(pkg, nil, pacmanCommand, "-R", "--noconfirm", pkg)
+}
+
+// Upgradable uses the local package databases, these are not synced.
+func (p *ArchLinuxInstaller) Upgradable(pkg string) bool {
+	out, ok := query(pacmanCommand, "-Qu", pkg)
+	return ok && out != ""
 }
@@ -1,30 +1,66 @@
 package ospkg
 
-import (
-	"os"
-	"os/exec"
-
-	"go.science.ru.nl/log"
-)
+import "strings"
 
 // DebianInstaller installs packages on Debian/Ubuntu.
 type DebianInstaller struct{}
 
 var _ Installer = (*DebianInstaller)(nil)
 
-const aptGetCommand = "/usr/bin/apt-get"
+const (
+	aptGetCommand    = "/usr/bin/apt-get"
+	aptCacheCommand  = "/usr/bin/apt-cache"
+	aptMarkCommand   = "/usr/bin/apt-mark"
+	dpkgQueryCommand = "/usr/bin/dpkg-query"
+)
 
+// Install installs pkg, this is allowed to change a held package, so a new version can be installed after Hold.
 func (p *DebianInstaller) Install(pkg string) error {
-	args := []string{"-qq", "--assume-yes", "--no-install-recommends", "install", pkg}
-	installCmd := exec.Command(aptGetCommand, args...)
-	installCmd.Env = append(os.Environ(),
-		"DEBIAN_FRONTEND=noninteractive",
-	)
-	out, err := installCmd.CombinedOutput()
-	if err != nil {
-		log.Warningf("Install failed: %s", out)
-	} else {
-		log.Infof("Already installed or re-installed %q", pkg)
+	env := []string{"DEBIAN_FRONTEND=noninteractive"}
+	return install(pkg, env, aptGetCommand, "-qq", "--assume-yes", "--allow-change-held-packages", "--no-install-recommends", "install", pkg)
+}
+
+func (p *DebianInstaller) Installed(pkg string) (string, bool) {
+	// removed, but not purged, packages are still known to dpkg, so the status must be checked.
+	out, ok := query(dpkgQueryCommand, "--show", "--showformat=${db:Status-Status} ${Version}", pkg)
+	status, version, _ := strings.Cut(out, " ")
+	if !ok || status != "installed" {
+		return "", false
 	}
+	return version, true
+}
+
+func (p *DebianInstaller) Hold(pkg string) error {
+	_, err := run(nil, aptMarkCommand, "hold", pkg)
 	return err
 }
+
+// Remove removes pkg, also when it's held.
+func (p *DebianInstaller) Remove(pkg string) error {
+	env := []string{"DEBIAN_FRONTEND=noninteractive"}
+	return remove(pkg, env, aptGetCommand, "-qq", "--assume-yes", "--allow-change-held-packages", "remove", pkg)
+}
+
+func (p *DebianInstaller) Upgradable(pkg string) bool {
+	// <pkg>:
+	//   Installed: <version>
+	//   Candidate: <version>
+	out, ok := query(aptCacheCommand, "policy", pkg)
+	if !ok {
+		return false
+	}
+	installed, candidate := "", ""
+	for _, l := range strings.Split(out, "\n") {
+		fields := strings.Fields(l)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "Installed:":
+			installed = fields[1]
+		case "Candidate:":
+			candidate = fields[1]
+		}
+	}
+	return installed != "" && installed != "(none)" && candidate != "" && candidate != "(none)" && installed != candidate
+}
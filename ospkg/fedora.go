@@ -0,0 +1,45 @@
+package ospkg
+
+// DnfInstaller installs packages on Fedora, RHEL and derivatives. When dnf isn't available, i.e. on RHEL 7, yum is
+// used. Holding packages needs the versionlock plugin.
+type DnfInstaller struct{}
+
+var _ Installer = (*DnfInstaller)(nil)
+
+const (
+	dnfCommand = "/usr/bin/dnf"
+	yumCommand = "/usr/bin/yum"
+)
+
+func (p *DnfInstaller) Install(pkg string) error {
+	name, version := Split(pkg)
+	if version != "" {
+		name += "-" + version
+	}
+	return install(pkg, nil, p.command(), "--quiet", "--assumeyes", "install", name)
+}
+
+func (p *DnfInstaller) Installed(pkg string) (string, bool) { return rpmInstalled(pkg) }
+
+func (p *DnfInstaller) Hold(pkg string) error {
+	_, err := run(nil, p.command(), "--quiet", "versionlock", "add", pkg)
+	return err
+}
+
+// command returns the dnf command, or yum if dnf can't be found.
+func (p *DnfInstaller) command() string {
+	if _, err := lookPath(dnfCommand); err != nil {
+		return yumCommand
+	}
+	return dnfCommand
+}
+
+func (p *DnfInstaller) Remove(pkg string) error {
+	return remove(pkg, nil, p.command(), "--quiet", "--assumeyes", "remove", pkg)
+}
+
+func (p *DnfInstaller) Upgradable(pkg string) bool {
+	// exits with an error when there are no updates for pkg.
+	out, ok := query(p.command(), "--quiet", "list", "updates", pkg)
+	return ok && out != ""
+}
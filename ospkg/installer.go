@@ -1,23 +1,104 @@
 package ospkg
 
 import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
 	"github.com/miekg/gitopper/osutil"
 	"go.science.ru.nl/log"
 )
 
-// Installer represents OS package installation tool.
+// Installer represents OS package installation tool. Packages given to Install may have a version constraint, see
+// Split, the other methods take a package name.
 type Installer interface {
+	// Install installs pkg.
 	Install(pkg string) error
+	// Installed returns the version of pkg and true if pkg is installed.
+	Installed(pkg string) (string, bool)
+	// Hold stops pkg from being upgraded by the system.
+	Hold(pkg string) error
+	// Remove removes pkg.
+	Remove(pkg string) error
+	// Upgradable returns true if a newer version of pkg is available.
+	Upgradable(pkg string) bool
 }
 
-// New returns an Installer suited for the current system, or the NoopInstaller when none are found.
+// New returns an Installer suited for the current system, or the NoopInstaller when none are found. If the ID of
+// the system isn't known, the IDs from ID_LIKE are tried in order.
 func New() Installer {
-	switch osutil.ID() {
-	case "debian", "ubuntu":
-		return new(DebianInstaller)
-	case "arch":
-		return new(ArchLinuxInstaller)
+	ids := append([]string{osutil.ID()}, osutil.IDLike()...)
+	if i := forID(ids); i != nil {
+		return i
 	}
 	log.Warningf("Returning Noop package installer for %s", osutil.ID())
 	return new(NoopInstaller)
 }
+
+// forID returns the Installer for the first of ids that is known, or nil if none are.
+func forID(ids []string) Installer {
+	for _, id := range ids {
+		switch id {
+		case "debian", "ubuntu":
+			return new(DebianInstaller)
+		case "arch":
+			return new(ArchLinuxInstaller)
+		case "fedora", "rhel", "centos", "rocky", "almalinux":
+			return new(DnfInstaller)
+		case "opensuse", "opensuse-leap", "opensuse-tumbleweed", "suse", "sles":
+			return new(ZypperInstaller)
+		case "alpine":
+			return new(AlpineInstaller)
+		case "void":
+			return new(VoidInstaller)
+		}
+	}
+	return nil
+}
+
+var (
+	// these are variables so they can be overridden during unit-testing.
+	run = func(env []string, name string, args ...string) ([]byte, error) {
+		cmd := exec.Command(name, args...)
+		if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		return cmd.CombinedOutput()
+	}
+	lookPath = exec.LookPath
+)
+
+// install runs the package manager name with args and env to install pkg.
+func install(pkg string, env []string, name string, args ...string) error {
+	out, err := run(env, name, args...)
+	if err != nil {
+		log.Warningf("Install failed: %s", out)
+	} else {
+		log.Infof("Installed %q", pkg)
+	}
+	return err
+}
+
+// remove runs the package manager name with args and env to remove pkg.
+func remove(pkg string, env []string, name string, args ...string) error {
+	out, err := run(env, name, args...)
+	if err != nil {
+		log.Warningf("Remove failed: %s", out)
+	} else {
+		log.Infof("Removed %q", pkg)
+	}
+	return err
+}
+
+// query runs the package manager name with args to query for a package, the output is returned.
+func query(name string, args ...string) (string, bool) {
+	out, err := run(nil, name, args...)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(out)), true
+}
+
+// ErrHold is returned by installers that don't support holding packages.
+var ErrHold = errors.New("holding packages is not supported")
@@ -0,0 +1,296 @@
+package ospkg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInstall(t *testing.T) {
+	var got []string
+	run = func(env []string, name string, args ...string) ([]byte, error) {
+		got = append(env, append([]string{name}, args...)...)
+		return nil, nil
+	}
+
+	tests := []struct {
+		installer Installer
+		noDnf     bool
+		expected  string
+	}{
+		{new(DebianInstaller), false, "DEBIAN_FRONTEND=noninteractive /usr/bin/apt-get -qq --assume-yes --allow-change-held-packages --no-install-recommends install prometheus"},
+		{new(ArchLinuxInstaller), false, "/usr/bin/pacman -S --noconfirm prometheus"},
+		{new(DnfInstaller), false, "/usr/bin/dnf --quiet --assumeyes install prometheus"},
+		{new(DnfInstaller), true, "/usr/bin/yum --quiet --assumeyes install prometheus"},
+		{new(ZypperInstaller), false, "/usr/bin/zypper --non-interactive --quiet install --no-recommends prometheus"},
+		{new(AlpineInstaller), false, "/sbin/apk add --quiet --no-progress prometheus"},
+		{new(VoidInstaller), false, "/usr/bin/xbps-install --yes prometheus"},
+	}
+	for i, tc := range tests {
+		lookPath = func(file string) (string, error) {
+			if tc.noDnf {
+				return "", fmt.Errorf("not found")
+			}
+			return file, nil
+		}
+		if err := tc.installer.Install("prometheus"); err != nil {
+			t.Fatalf("test %d, expected no error, got %s", i, err)
+		}
+		if x := strings.Join(got, " "); x != tc.expected {
+			t.Errorf("test %d, expected %q, got %q", i, tc.expected, x)
+		}
+	}
+}
+
+func TestInstallVersion(t *testing.T) {
+	var got []string
+	run = func(env []string, name string, args ...string) ([]byte, error) {
+		got = append(env, append([]string{name}, args...)...)
+		return nil, nil
+	}
+
+	tests := []struct {
+		installer Installer
+		pkg       string
+		expected  string // last argument, empty for an error
+	}{
+		{new(AlpineInstaller), "prometheus=2.45.0-r1", "prometheus=2.45.0-r1"},
+		{new(AlpineInstaller), "prometheus=2.45.*", "prometheus~2.45"},
+		{new(AlpineInstaller), "prometheus=2.45*", "prometheus~2.45"},
+		{new(AlpineInstaller), "prometheus=2.*.1", ""},
+		{new(ZypperInstaller), "prometheus=2.45.0", "prometheus=2.45.0"},
+		{new(ZypperInstaller), "prometheus=2.45.*", "prometheus<2.46"},
+		{new(ZypperInstaller), "prometheus=2.*", "prometheus<3"},
+		{new(ZypperInstaller), "prometheus=2.45.0-?", ""},
+		{new(ZypperInstaller), "prometheus=2.45rc*", ""},
+	}
+	for i, tc := range tests {
+		got = nil
+		err := tc.installer.Install(tc.pkg)
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf("test %d, expected error for %q, got %v", i, tc.pkg, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d, expected no error, got %s", i, err)
+		}
+		if x := got[len(got)-1]; x != tc.expected {
+			t.Errorf("test %d, expected %q, got %q", i, tc.expected, x)
+		}
+	}
+}
+
+func TestForID(t *testing.T) {
+	tests := []struct {
+		ids      []string
+		expected Installer
+	}{
+		{[]string{"ubuntu", "debian"}, new(DebianInstaller)},
+		{[]string{"rhel", "fedora"}, new(DnfInstaller)},
+		{[]string{"ol", "fedora"}, new(DnfInstaller)},
+		{[]string{"opensuse-leap", "suse", "opensuse"}, new(ZypperInstaller)},
+		{[]string{"alpine"}, new(AlpineInstaller)},
+		{[]string{"void"}, new(VoidInstaller)},
+		{[]string{"plan9"}, nil},
+	}
+	for i, tc := range tests {
+		if x := forID(tc.ids); !reflect.DeepEqual(x, tc.expected) {
+			t.Errorf("test %d, expected %T, got %T", i, tc.expected, x)
+		}
+	}
+}
+
+func TestInstalled(t *testing.T) {
+	lookPath = func(file string) (string, error) { return file, nil }
+	tests := []struct {
+		installer Installer
+		out       string
+		version   string
+		ok        bool
+	}{
+		{new(DebianInstaller), "installed 2.45.1+ds-1", "2.45.1+ds-1", true},
+		{new(DebianInstaller), "config-files 2.45.1+ds-1", "", false},
+		{new(ArchLinuxInstaller), "prometheus 2.45.0-1", "2.45.0-1", true},
+		{new(DnfInstaller), "2.45.0-1.el9", "2.45.0-1.el9", true},
+		{new(ZypperInstaller), "2.45.0-1.1", "2.45.0-1.1", true},
+		{new(AlpineInstaller), "prometheus-2.45.0-r1", "2.45.0-r1", true},
+		{new(VoidInstaller), "prometheus-2.45.0_1", "2.45.0_1", true},
+	}
+	for i, tc := range tests {
+		run = func(env []string, name string, args ...string) ([]byte, error) { return []byte(tc.out + "\n"), nil }
+		version, ok := tc.installer.Installed("prometheus")
+		if version != tc.version || ok != tc.ok {
+			t.Errorf("test %d, expected %q, %t, got %q, %t", i, tc.version, tc.ok, version, ok)
+		}
+	}
+
+	run = func(env []string, name string, args ...string) ([]byte, error) {
+		return nil, fmt.Errorf("exit status 1")
+	}
+	if _, ok := new(DnfInstaller).Installed("prometheus"); ok {
+		t.Errorf("expected package not to be installed")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var got []string
+	run = func(env []string, name string, args ...string) ([]byte, error) {
+		got = append(env, append([]string{name}, args...)...)
+		return nil, nil
+	}
+	lookPath = func(file string) (string, error) { return file, nil }
+
+	tests := []struct {
+		installer Installer
+		expected  string
+	}{
+		{new(DebianInstaller), "DEBIAN_FRONTEND=noninteractive /usr/bin/apt-get -qq --assume-yes --allow-change-held-packages remove prometheus"},
+		{new(ArchLinuxInstaller), "/usr/bin/pacman -R --noconfirm prometheus"},
+		{new(DnfInstaller), "/usr/bin/dnf --quiet --assumeyes remove prometheus"},
+		{new(ZypperInstaller), "/usr/bin/zypper --non-interactive --quiet remove prometheus"},
+		{new(AlpineInstaller), "/sbin/apk del --quiet --no-progress prometheus"},
+		{new(VoidInstaller), "/usr/bin/xbps-remove --yes prometheus"},
+	}
+	for i, tc := range tests {
+		if err := tc.installer.Remove("prometheus"); err != nil {
+			t.Fatalf("test %d, expected no error, got %s", i, err)
+		}
+		if x := strings.Join(got, " "); x != tc.expected {
+			t.Errorf("test %d, expected %q, got %q", i, tc.expected, x)
+		}
+	}
+}
+
+func TestUpgradable(t *testing.T) {
+	lookPath = func(file string) (string, error) { return file, nil }
+	tests := []struct {
+		installer Installer
+		out       string
+		expected  bool
+	}{
+		{new(DebianInstaller), "prometheus:\n  Installed: 2.44.0+ds-1\n  Candidate: 2.45.0+ds-1\n  Version table:", true},
+		{new(DebianInstaller), "prometheus:\n  Installed: 2.45.0+ds-1\n  Candidate: 2.45.0+ds-1\n  Version table:", false},
+		{new(DebianInstaller), "prometheus:\n  Installed: (none)\n  Candidate: 2.45.0+ds-1\n  Version table:", false},
+		{new(ArchLinuxInstaller), "prometheus 2.44.0-1 -> 2.45.0-1", true},
+		{new(ArchLinuxInstaller), "", false},
+		{new(DnfInstaller), "Available Upgrades\nprometheus.x86_64  2.45.0-1.el9  epel", true},
+		{new(ZypperInstaller), "Name           : prometheus\nStatus         : out-of-date (version 2.44.0-1.1 installed)", true},
+		{new(ZypperInstaller), "Name           : prometheus\nStatus         : up-to-date", false},
+		{new(AlpineInstaller), "Installed:                                Available:\nprometheus-2.44.0-r1            < 2.45.0-r0", true},
+		{new(AlpineInstaller), "Installed:                                Available:", false},
+		{new(VoidInstaller), "prometheus-2.45.0_1 update x86_64 https://repo-default.voidlinux.org/current 1234 5678", true},
+	}
+	for i, tc := range tests {
+		run = func(env []string, name string, args ...string) ([]byte, error) { return []byte(tc.out + "\n"), nil }
+		if x := tc.installer.Upgradable("prometheus"); x != tc.expected {
+			t.Errorf("test %d, expected %t, got %t", i, tc.expected, x)
+		}
+	}
+}
+
+// fake is an Installer that keeps the installed packages in memory.
+type fake struct {
+	installed map[string]string // name -> version
+	available string            // version installed by Install
+	calls     []string
+}
+
+func (f *fake) Install(pkg string) error {
+	f.calls = append(f.calls, "install "+pkg)
+	name, _ := Split(pkg)
+	f.installed[name] = f.available
+	return nil
+}
+
+func (f *fake) Installed(pkg string) (string, bool) {
+	v, ok := f.installed[pkg]
+	return v, ok
+}
+
+func (f *fake) Hold(pkg string) error {
+	f.calls = append(f.calls, "hold "+pkg)
+	return nil
+}
+
+func (f *fake) Remove(pkg string) error {
+	f.calls = append(f.calls, "remove "+pkg)
+	delete(f.installed, pkg)
+	return nil
+}
+
+func (f *fake) Upgradable(pkg string) bool { return false }
+
+func TestEnsure(t *testing.T) {
+	tests := []struct {
+		installed map[string]string
+		available string
+		pkg       string
+		hold      bool
+		expected  []string
+		err       bool
+	}{
+		{map[string]string{}, "2.45.0", "prometheus", false, []string{"install prometheus"}, false},
+		{map[string]string{"prometheus": "2.44.0"}, "2.45.0", "prometheus", false, nil, false},
+		{map[string]string{"prometheus": "2.45.0"}, "2.45.0", "prometheus=2.45.*", true, []string{"hold prometheus"}, false},
+		{map[string]string{"prometheus": "2.44.0"}, "2.45.1", "prometheus=2.45.*", true, []string{"install prometheus=2.45.*", "hold prometheus"}, false},
+		{map[string]string{"prometheus": "2.44.0"}, "2.44.1", "prometheus=2.45.*", false, []string{"install prometheus=2.45.*"}, true},
+	}
+	for i, tc := range tests {
+		f := &fake{installed: tc.installed, available: tc.available}
+		_, err := Ensure(f, tc.pkg, tc.hold)
+		if tc.err && err == nil {
+			t.Errorf("test %d, expected error, got none", i)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("test %d, expected no error, got %s", i, err)
+		}
+		if !reflect.DeepEqual(f.calls, tc.expected) {
+			t.Errorf("test %d, expected %v, got %v", i, tc.expected, f.calls)
+		}
+	}
+}
+
+func TestEnsureNoop(t *testing.T) {
+	for _, pkg := range []string{"prometheus", "prometheus=2.45.*"} {
+		if Needed(new(NoopInstaller), pkg) {
+			t.Errorf("expected %q not to be needed with the noop installer", pkg)
+		}
+		installed, err := Ensure(new(NoopInstaller), pkg, true)
+		if err != nil {
+			t.Errorf("expected no error for %q, got %s", pkg, err)
+		}
+		if installed {
+			t.Errorf("expected %q not to be installed with the noop installer", pkg)
+		}
+	}
+}
+
+func TestDebianHeldVersion(t *testing.T) {
+	var got [][]string
+	run = func(env []string, name string, args ...string) ([]byte, error) {
+		got = append(got, append([]string{name}, args...))
+		return nil, nil
+	}
+
+	p := new(DebianInstaller)
+	if err := p.Hold("prometheus"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Install("prometheus=2.46.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Remove("prometheus"); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{aptMarkCommand, "hold", "prometheus"},
+		{aptGetCommand, "-qq", "--assume-yes", "--allow-change-held-packages", "--no-install-recommends", "install", "prometheus=2.46.0"},
+		{aptGetCommand, "-qq", "--assume-yes", "--allow-change-held-packages", "remove", "prometheus"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -8,3 +8,12 @@ type NoopInstaller struct{}
 var _ Installer = (*NoopInstaller)(nil)
 
 func (p *NoopInstaller) Install(pkg string) error { return nil }
+
+// Installed always returns true, without a version, so nothing is ever installed.
+func (p *NoopInstaller) Installed(pkg string) (string, bool) { return "", true }
+
+func (p *NoopInstaller) Hold(pkg string) error { return nil }
+
+func (p *NoopInstaller) Remove(pkg string) error { return nil }
+
+func (p *NoopInstaller) Upgradable(pkg string) bool { return false }
@@ -0,0 +1,93 @@
+package ospkg
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Split splits the package pkg into its name and version constraint. A version constraint is given after a '=', as in
+// "prometheus=2.45.*", and is a glob pattern that the version of the installed package must match.
+func Split(pkg string) (name, version string) {
+	name, version, _ = strings.Cut(pkg, "=")
+	return name, version
+}
+
+// Ensure makes sure pkg is installed with i: it is only installed when it's not installed yet, or when the installed
+// version doesn't match the version constraint of pkg. After installation the version is checked again. If hold is
+// true, the package is held, so the system won't upgrade it. The returned bool is true if pkg was installed.
+func Ensure(i Installer, pkg string, hold bool) (bool, error) {
+	name, version := Split(pkg)
+	installed := false
+	if Needed(i, pkg) {
+		if err := i.Install(pkg); err != nil {
+			return false, err
+		}
+		installed = true
+		if v, ok := i.Installed(name); !ok {
+			return true, fmt.Errorf("package %q is not installed after installation", name)
+		} else if !match(version, v) {
+			return true, fmt.Errorf("installed version %q of package %q does not match %q", v, name, version)
+		}
+	}
+	if hold {
+		if err := i.Hold(name); err != nil {
+			return installed, err
+		}
+	}
+	return installed, nil
+}
+
+// Needed returns true if pkg needs to be installed with i, because it's not installed or the installed version doesn't
+// match the version constraint of pkg. The NoopInstaller doesn't manage packages, so nothing is ever needed.
+func Needed(i Installer, pkg string) bool {
+	if _, ok := i.(*NoopInstaller); ok {
+		return false
+	}
+	name, version := Split(pkg)
+	v, ok := i.Installed(name)
+	return !ok || !match(version, v)
+}
+
+// match returns true if the version v matches the version constraint c. An empty c matches any version.
+func match(c, v string) bool {
+	if c == "" {
+		return true
+	}
+	ok, _ := path.Match(c, v)
+	return ok
+}
+
+// isGlob returns true if the version v contains glob meta characters.
+func isGlob(v string) bool { return strings.ContainsAny(v, `*?[\`) }
+
+// globPrefix returns the version prefix of the glob v, if v is of the form "<prefix>*" or "<prefix>.*" and has no
+// other meta characters, i.e. "2.45" for "2.45.*".
+func globPrefix(v string) (string, bool) {
+	if !strings.HasSuffix(v, "*") {
+		return "", false
+	}
+	prefix := strings.TrimSuffix(v, "*")
+	if isGlob(prefix) {
+		return "", false
+	}
+	prefix = strings.TrimSuffix(prefix, ".")
+	return prefix, prefix != ""
+}
+
+// nextVersion returns the version that follows all versions starting with prefix, i.e. "2.46" for "2.45". The last
+// component of prefix must be numeric.
+func nextVersion(prefix string) (string, bool) {
+	i := strings.LastIndex(prefix, ".") + 1
+	n, err := strconv.ParseUint(prefix[i:], 10, 32)
+	if err != nil {
+		return "", false
+	}
+	return prefix[:i] + strconv.FormatUint(n+1, 10), true
+}
+
+// errVersion returns the error for a version constraint of pkg that can't be expressed for the package manager name.
+func errVersion(pkg, name string) error {
+	return fmt.Errorf("version constraint of package %q can't be expressed for %s, use a version or a prefix like \"2.45.*\"", pkg, name)
+}
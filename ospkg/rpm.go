@@ -0,0 +1,8 @@
+package ospkg
+
+const rpmCommand = "/usr/bin/rpm"
+
+// rpmInstalled returns the version and release of pkg as "<version>-<release>" and true if pkg is installed.
+func rpmInstalled(pkg string) (string, bool) {
+	return query(rpmCommand, "--query", "--queryformat=%{VERSION}-%{RELEASE}", pkg)
+}
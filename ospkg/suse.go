@@ -0,0 +1,64 @@
+package ospkg
+
+import "strings"
+
+// ZypperInstaller installs packages on openSUSE and SLES.
+type ZypperInstaller struct{}
+
+var _ Installer = (*ZypperInstaller)(nil)
+
+const zypperCommand = "/usr/bin/zypper"
+
+func (p *ZypperInstaller) Install(pkg string) error {
+	arg, err := zypperPackage(pkg)
+	if err != nil {
+		return err
+	}
+	return install(pkg, nil, zypperCommand, "--non-interactive", "--quiet", "install", "--no-recommends", arg)
+}
+
+// zypperPackage returns pkg in zypper's syntax, a version prefix glob is translated to an upper bound, i.e.
+// "prometheus=2.45.*" becomes "prometheus<2.46".
+func zypperPackage(pkg string) (string, error) {
+	name, version := Split(pkg)
+	switch {
+	case version == "":
+		return name, nil
+	case !isGlob(version):
+		return name + "=" + version, nil
+	}
+	prefix, ok := globPrefix(version)
+	if !ok {
+		return "", errVersion(pkg, "zypper")
+	}
+	next, ok := nextVersion(prefix)
+	if !ok {
+		return "", errVersion(pkg, "zypper")
+	}
+	return name + "<" + next, nil
+}
+
+func (p *ZypperInstaller) Installed(pkg string) (string, bool) { return rpmInstalled(pkg) }
+
+func (p *ZypperInstaller) Hold(pkg string) error {
+	_, err := run(nil, zypperCommand, "--non-interactive", "--quiet", "addlock", pkg)
+	return err
+}
+
+func (p *ZypperInstaller) Remove(pkg string) error {
+	return remove(pkg, nil, zypperCommand, "--non-interactive", "--quiet", "remove", pkg)
+}
+
+func (p *ZypperInstaller) Upgradable(pkg string) bool {
+	out, ok := query(zypperCommand, "--non-interactive", "--quiet", "info", pkg)
+	if !ok {
+		return false
+	}
+	for _, l := range strings.Split(out, "\n") {
+		// Status         : out-of-date (version 2.44.0-1.1 installed)
+		if key, val, ok := strings.Cut(l, ":"); ok && strings.TrimSpace(key) == "Status" {
+			return strings.HasPrefix(strings.TrimSpace(val), "out-of-date")
+		}
+	}
+	return false
+}
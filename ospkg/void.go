@@ -0,0 +1,52 @@
+package ospkg
+
+import "strings"
+
+// VoidInstaller installs packages on Void Linux. The version constraint is only checked after installation.
+type VoidInstaller struct{}
+
+var _ Installer = (*VoidInstaller)(nil)
+
+const (
+	xbpsInstallCommand = "/usr/bin/xbps-install"
+	xbpsQueryCommand   = "/usr/bin/xbps-query"
+	xbpsPkgdbCommand   = "/usr/bin/xbps-pkgdb"
+	xbpsRemoveCommand  = "/usr/bin/xbps-remove"
+)
+
+func (p *VoidInstaller) Install(pkg string) error {
+	name, _ := Split(pkg)
+	return install(pkg, nil, xbpsInstallCommand, "--yes", name)
+}
+
+func (p *VoidInstaller) Installed(pkg string) (string, bool) {
+	// <name>-<version>_<revision>
+	out, ok := query(xbpsQueryCommand, "--property", "pkgver", pkg)
+	if !ok || !strings.HasPrefix(out, pkg+"-") {
+		return "", false
+	}
+	return strings.TrimPrefix(out, pkg+"-"), true
+}
+
+func (p *VoidInstaller) Hold(pkg string) error {
+	_, err := run(nil, xbpsPkgdbCommand, "--mode", "hold", pkg)
+	return err
+}
+
+func (p *VoidInstaller) Remove(pkg string) error {
+	return remove(pkg, nil, xbpsRemoveCommand, "--yes", pkg)
+}
+
+func (p *VoidInstaller) Upgradable(pkg string) bool {
+	// <name>-<version> update <arch> <repository> ...
+	out, ok := query(xbpsInstallCommand, "--update", "--dry-run", pkg)
+	if !ok {
+		return false
+	}
+	for _, l := range strings.Split(out, "\n") {
+		if fields := strings.Fields(l); len(fields) > 1 && strings.HasPrefix(fields[0], pkg+"-") && fields[1] == "update" {
+			return true
+		}
+	}
+	return false
+}
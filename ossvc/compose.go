@@ -0,0 +1,98 @@
+package ossvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Compose manages a docker (or podman) compose project.
+type Compose struct {
+	Bin     string // The binary to use, "docker" (the default) or "podman".
+	File    string // Compose file, if empty Dir is used to find it.
+	Dir     string // Project directory.
+	Project string // Project name.
+}
+
+var _ ServiceManager = (*Compose)(nil)
+
+func (p *Compose) compose(args ...string) ([]byte, error) {
+	bin := p.Bin
+	if bin == "" {
+		bin = "docker"
+	}
+	pre := []string{"compose", "-p", p.Project}
+	if p.File != "" {
+		pre = append(pre, "-f", p.File)
+	}
+	if p.Dir != "" {
+		pre = append(pre, "--project-directory", p.Dir)
+	}
+	out, err := run(bin, append(pre, args...)...)
+	if err != nil {
+		return out, fmt.Errorf("%s: %s", err, bytes.TrimSpace(out))
+	}
+	return out, nil
+}
+
+// Reload is a noop, compose reads the compose file each time.
+func (p *Compose) Reload() error { return nil }
+
+func (p *Compose) Start(service string) error {
+	_, err := p.compose("up", "-d")
+	return err
+}
+
+// Enable is a noop, containers are (re)started by the container runtime.
+func (p *Compose) Enable(service string) error { return nil }
+
+// Action performs action: "up" runs "compose up -d" and "pull" runs "compose pull" followed by "compose up -d".
+func (p *Compose) Action(action, service string) error {
+	switch action {
+	case "pull":
+		if _, err := p.compose("pull"); err != nil {
+			return err
+		}
+		fallthrough
+	case "up":
+		_, err := p.compose("up", "-d")
+		return err
+	}
+	return fmt.Errorf("action %q: %w", action, ErrNotSupported)
+}
+
+func (p *Compose) StartTime(service string) (time.Time, error) { return time.Time{}, ErrNotSupported }
+
+type container struct {
+	State  string
+	Health string
+}
+
+// IsActive returns true when the project has containers and all are running and none are unhealthy.
+func (p *Compose) IsActive(service string) (bool, error) {
+	out, err := p.compose("ps", "--all", "--format", "json")
+	if err != nil {
+		return false, err
+	}
+	containers := []container{}
+	// Depending on the version this is a JSON array, or a JSON object per line.
+	if err := json.Unmarshal(out, &containers); err != nil {
+		for _, line := range bytes.Split(bytes.TrimSpace(out), []byte("\n")) {
+			c := container{}
+			if err := json.Unmarshal(line, &c); err != nil {
+				return false, err
+			}
+			containers = append(containers, c)
+		}
+	}
+	if len(containers) == 0 {
+		return false, nil
+	}
+	for _, c := range containers {
+		if c.State != "running" || c.Health == "unhealthy" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,46 @@
+package ossvc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	defer func(r func(string, ...string) ([]byte, error)) { run = r }(run)
+
+	psArgs := []string{"compose", "-p", "caddy", "-f", "/srv/caddy/compose.yaml", "ps", "--all", "--format", "json"}
+	calls := [][]string{}
+	ps := `{"Name":"caddy-caddy-1","State":"running","Health":""}
+{"Name":"caddy-db-1","State":"running","Health":"healthy"}`
+	run = func(name string, args ...string) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		if reflect.DeepEqual(args, psArgs) {
+			return []byte(ps), nil
+		}
+		return nil, nil
+	}
+	p := &Compose{Bin: "podman", File: "/srv/caddy/compose.yaml", Project: "caddy"}
+	if err := p.Action("pull", "caddy"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := p.IsActive("caddy"); err != nil || !ok {
+		t.Errorf("expected project to be active, got %t: %v", ok, err)
+	}
+
+	expect := [][]string{
+		{"podman", "compose", "-p", "caddy", "-f", "/srv/caddy/compose.yaml", "pull"},
+		{"podman", "compose", "-p", "caddy", "-f", "/srv/caddy/compose.yaml", "up", "-d"},
+		append([]string{"podman"}, psArgs...),
+	}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("expected calls %v, got %v", expect, calls)
+	}
+
+	ps = `[{"Name":"caddy-caddy-1","State":"exited","Health":""}]`
+	if ok, _ := p.IsActive("caddy"); ok {
+		t.Errorf("expected project to be inactive, got active")
+	}
+	if err := p.Action("restart", "caddy"); err == nil {
+		t.Errorf("expected error for unknown action, got none")
+	}
+}
@@ -0,0 +1,46 @@
+package ossvc
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fake is a ServiceManager that records all calls made to it, it is used in testing.
+type Fake struct {
+	Err      error // If not nil, this error is returned from Action.
+	Inactive bool  // If true, IsActive returns false.
+
+	mu    sync.Mutex
+	calls []string
+}
+
+var _ ServiceManager = (*Fake)(nil)
+
+func (p *Fake) record(args ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, strings.Join(args, " "))
+}
+
+// Calls returns all calls made, each call is the method name in lowercase followed by its arguments.
+func (p *Fake) Calls() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.calls...)
+}
+
+func (p *Fake) Reload() error { p.record("reload"); return nil }
+
+func (p *Fake) Start(service string) error { p.record("start", service); return nil }
+
+func (p *Fake) Enable(service string) error { p.record("enable", service); return nil }
+
+func (p *Fake) Action(action, service string) error {
+	p.record("action", action, service)
+	return p.Err
+}
+
+func (p *Fake) StartTime(service string) (time.Time, error) { return time.Now(), nil }
+
+func (p *Fake) IsActive(service string) (bool, error) { return !p.Inactive, nil }
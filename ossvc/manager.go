@@ -0,0 +1,101 @@
+// Package ossvc abstracts the service manager (init system) that is used to act on services.
+package ossvc
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/miekg/gitopper/osutil"
+	"go.science.ru.nl/log"
+)
+
+// ServiceManager represents the service manager of the OS.
+type ServiceManager interface {
+	// Reload makes the service manager reload its configuration, i.e. systemctl daemon-reload.
+	Reload() error
+	// Start starts service.
+	Start(service string) error
+	// Enable enables service, so it's started on boot.
+	Enable(service string) error
+	// Action performs action, i.e. "reload" or "restart", on service.
+	Action(action, service string) error
+	// StartTime returns the time service was started. If service is empty the boot time of the system is returned.
+	StartTime(service string) (time.Time, error)
+	// IsActive returns true if service is running.
+	IsActive(service string) (bool, error)
+}
+
+// ErrNotSupported is returned when a service manager doesn't support an operation.
+var ErrNotSupported = errors.New("not supported")
+
+// New returns the ServiceManager with name. When name is empty a ServiceManager suited for the current system is
+// returned, this is systemd unless the system is known to use something else.
+func New(name string) ServiceManager {
+	if name == "" {
+		name = system()
+	}
+	switch name {
+	case "systemd":
+		return new(Systemd)
+	case "openrc":
+		return new(OpenRC)
+	case "runit":
+		return new(Runit)
+	case "s6":
+		return new(S6)
+	case "signal":
+		return new(Signal)
+	}
+	log.Warningf("Unknown service manager %q, using systemd", name)
+	return new(Systemd)
+}
+
+// system returns the name of the service manager of the current system.
+func system() string {
+	switch osutil.ID() {
+	case "alpine", "gentoo":
+		return "openrc"
+	case "void":
+		return "runit"
+	}
+	return "systemd"
+}
+
+// Actions returns the actions service manager name supports, or nil if name is unknown. When name is empty the actions
+// of the service manager of the current system are returned, as New picks that one.
+func Actions(name string) []string {
+	if name == "" {
+		name = system()
+	}
+	switch name {
+	case "openrc", "runit":
+		return []string{"reload", "restart", "start", "stop"}
+	case "systemd":
+		return []string{"reload", "restart", "start", "stop", "try-restart", "reload-or-restart", "try-reload-or-restart"}
+	case "s6":
+		return keys(s6Actions)
+	case "signal":
+		return keys(signals)
+	}
+	return nil
+}
+
+func keys[T any](m map[string]T) []string {
+	k := make([]string, 0, len(m))
+	for a := range m {
+		k = append(k, a)
+	}
+	sort.Strings(k)
+	return k
+}
+
+// run runs the command name with args and returns the combined output. This is a variable so it can be overridden
+// during unit-testing.
+var run = func(name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(context.TODO(), name, args...)
+	log.Infof("running %v", cmd.Args)
+	return cmd.CombinedOutput()
+}
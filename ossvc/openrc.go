@@ -0,0 +1,41 @@
+package ossvc
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// OpenRC manages services with rc-service and rc-update.
+type OpenRC struct{}
+
+var _ ServiceManager = (*OpenRC)(nil)
+
+// Reload is a noop, OpenRC reads its scripts when they are used.
+func (p *OpenRC) Reload() error { return nil }
+
+func (p *OpenRC) Start(service string) error {
+	_, err := run("rc-service", service, "start")
+	return err
+}
+
+func (p *OpenRC) Enable(service string) error {
+	_, err := run("rc-update", "add", service, "default")
+	return err
+}
+
+func (p *OpenRC) Action(action, service string) error {
+	_, err := run("rc-service", service, action)
+	return err
+}
+
+func (p *OpenRC) StartTime(service string) (time.Time, error) { return time.Time{}, ErrNotSupported }
+
+func (p *OpenRC) IsActive(service string) (bool, error) {
+	_, err := run("rc-service", service, "status")
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
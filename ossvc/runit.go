@@ -0,0 +1,67 @@
+package ossvc
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+)
+
+// Runit manages services with sv.
+type Runit struct {
+	Dir string // Directory where enabled services are linked, defaults to /var/service.
+}
+
+var _ ServiceManager = (*Runit)(nil)
+
+// Reload is a noop, runsvdir picks up changes by itself.
+func (p *Runit) Reload() error { return nil }
+
+func (p *Runit) Start(service string) error {
+	_, err := run("sv", "up", service)
+	return err
+}
+
+// Enable links /etc/sv/<service> into the service directory.
+func (p *Runit) Enable(service string) error {
+	dir := p.Dir
+	if dir == "" {
+		dir = "/var/service"
+	}
+	_, err := run("ln", "-sfn", path.Join("/etc/sv", service), path.Join(dir, service))
+	return err
+}
+
+func (p *Runit) Action(action, service string) error {
+	_, err := run("sv", action, service)
+	return err
+}
+
+// StartTime parses the output of sv status, which looks like: "run: prometheus: (pid 123) 456s".
+func (p *Runit) StartTime(service string) (time.Time, error) {
+	if service == "" {
+		return time.Time{}, ErrNotSupported
+	}
+	out, err := run("sv", "status", service)
+	if err != nil {
+		return time.Time{}, err
+	}
+	fields := bytes.Fields(out)
+	if len(fields) < 5 || !bytes.Equal(fields[0], []byte("run:")) {
+		return time.Time{}, fmt.Errorf("service %q is not running", service)
+	}
+	secs, err := strconv.ParseInt(string(bytes.TrimRight(fields[4], "s;")), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-time.Duration(secs) * time.Second), nil
+}
+
+func (p *Runit) IsActive(service string) (bool, error) {
+	out, err := run("sv", "status", service)
+	if err != nil {
+		return false, err
+	}
+	return bytes.HasPrefix(out, []byte("run:")), nil
+}
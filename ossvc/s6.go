@@ -0,0 +1,79 @@
+package ossvc
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+)
+
+// S6 manages services with s6-svc.
+type S6 struct {
+	Dir string // The scan directory, defaults to /run/service.
+}
+
+var _ ServiceManager = (*S6)(nil)
+
+func (p *S6) dir(service string) string {
+	dir := p.Dir
+	if dir == "" {
+		dir = "/run/service"
+	}
+	return path.Join(dir, service)
+}
+
+// Reload is a noop, s6-svscan picks up changes by itself.
+func (p *S6) Reload() error { return nil }
+
+func (p *S6) Start(service string) error {
+	_, err := run("s6-svc", "-u", p.dir(service))
+	return err
+}
+
+// Enable is a noop, services in the scan directory are enabled.
+func (p *S6) Enable(service string) error { return nil }
+
+var s6Actions = map[string]string{
+	"reload":  "-h",
+	"restart": "-r",
+	"start":   "-u",
+	"stop":    "-d",
+}
+
+func (p *S6) Action(action, service string) error {
+	flag, ok := s6Actions[action]
+	if !ok {
+		return fmt.Errorf("action %q: %w", action, ErrNotSupported)
+	}
+	_, err := run("s6-svc", flag, p.dir(service))
+	return err
+}
+
+// StartTime parses the output of s6-svstat, which looks like: "true 456".
+func (p *S6) StartTime(service string) (time.Time, error) {
+	if service == "" {
+		return time.Time{}, ErrNotSupported
+	}
+	out, err := run("s6-svstat", "-o", "up,updownfor", p.dir(service))
+	if err != nil {
+		return time.Time{}, err
+	}
+	fields := bytes.Fields(out)
+	if len(fields) != 2 || !bytes.Equal(fields[0], []byte("true")) {
+		return time.Time{}, fmt.Errorf("service %q is not running", service)
+	}
+	secs, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-time.Duration(secs) * time.Second), nil
+}
+
+func (p *S6) IsActive(service string) (bool, error) {
+	out, err := run("s6-svstat", "-o", "up", p.dir(service))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(bytes.TrimSpace(out), []byte("true")), nil
+}
@@ -0,0 +1,90 @@
+package ossvc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.science.ru.nl/log"
+)
+
+// Signal manages a service by sending signals to the PID found in a pidfile.
+type Signal struct {
+	Pidfile string
+}
+
+var _ ServiceManager = (*Signal)(nil)
+
+func (p *Signal) pid() (int, error) {
+	buf, err := os.ReadFile(p.Pidfile)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(bytes.TrimSpace(buf)))
+}
+
+// Reload is a noop.
+func (p *Signal) Reload() error { return nil }
+
+// Start can't start a service, it returns an error if the service isn't running.
+func (p *Signal) Start(service string) error {
+	ok, err := p.IsActive(service)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("service %q is not running", service)
+	}
+	return nil
+}
+
+// Enable is a noop.
+func (p *Signal) Enable(service string) error { return nil }
+
+var signals = map[string]syscall.Signal{
+	"reload": syscall.SIGHUP,
+	"hup":    syscall.SIGHUP,
+	"usr1":   syscall.SIGUSR1,
+	"usr2":   syscall.SIGUSR2,
+	"term":   syscall.SIGTERM,
+}
+
+// Action sends a signal to the process: "reload" and "hup" send a SIGHUP, "usr1", "usr2" and "term" send SIGUSR1,
+// SIGUSR2 and SIGTERM respectively.
+func (p *Signal) Action(action, service string) error {
+	sig, ok := signals[strings.ToLower(action)]
+	if !ok {
+		return fmt.Errorf("action %q: %w", action, ErrNotSupported)
+	}
+	pid, err := p.pid()
+	if err != nil {
+		return err
+	}
+	log.Infof("Sending %s to %d", sig, pid)
+	return syscall.Kill(pid, sig)
+}
+
+// StartTime returns the modification time of /proc/<pid>, which is when the process started.
+func (p *Signal) StartTime(service string) (time.Time, error) {
+	pid, err := p.pid()
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := os.Stat("/proc/" + strconv.Itoa(pid))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (p *Signal) IsActive(service string) (bool, error) {
+	pid, err := p.pid()
+	if err != nil {
+		return false, err
+	}
+	return syscall.Kill(pid, 0) == nil, nil
+}
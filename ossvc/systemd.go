@@ -0,0 +1,68 @@
+package ossvc
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// Systemd manages services with systemctl.
+type Systemd struct {
+	User bool // If true, use the user's service manager, i.e. systemctl --user.
+}
+
+var _ ServiceManager = (*Systemd)(nil)
+
+func (p *Systemd) systemctl(args ...string) ([]byte, error) {
+	if p.User {
+		args = append([]string{"--user"}, args...)
+	}
+	return run("systemctl", args...)
+}
+
+func (p *Systemd) Reload() error {
+	_, err := p.systemctl("daemon-reload")
+	return err
+}
+
+func (p *Systemd) Start(service string) error {
+	_, err := p.systemctl("start", service)
+	return err
+}
+
+func (p *Systemd) Enable(service string) error {
+	_, err := p.systemctl("enable", service)
+	return err
+}
+
+func (p *Systemd) Action(action, service string) error {
+	_, err := p.systemctl(action, service)
+	return err
+}
+
+func (p *Systemd) StartTime(service string) (time.Time, error) {
+	var (
+		out []byte
+		err error
+	)
+	if service != "" {
+		out, err = p.systemctl("show", "--value", "--property=ExecMainStartTimestamp", service)
+	} else {
+		out, err = p.systemctl("show", "--value", "--property=KernelTimestamp")
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Testing show this is the string returned: Mon 2022-11-21 09:39:59 CET, so parse that into a time.Time
+	return time.Parse("Mon 2006-01-02 15:04:05 MST", string(bytes.TrimSpace(out)))
+}
+
+func (p *Systemd) IsActive(service string) (bool, error) {
+	_, err := p.systemctl("is-active", "--quiet", service)
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,35 @@
+package ossvc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSystemd(t *testing.T) {
+	defer func(r func(string, ...string) ([]byte, error)) { run = r }(run)
+
+	calls := [][]string{}
+	run = func(name string, args ...string) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return []byte("Mon 2022-11-21 09:39:59 UTC\n"), nil
+	}
+	p := &Systemd{User: true}
+	if err := p.Action("reload", "prometheus"); err != nil {
+		t.Fatal(err)
+	}
+	start, err := p.StartTime("prometheus")
+	if err != nil {
+		t.Fatalf("expected to parse start time, got: %s", err)
+	}
+	if start.Day() != 21 || start.Hour() != 9 {
+		t.Errorf("expected start time to be parsed, got %s", start)
+	}
+
+	expect := [][]string{
+		{"systemctl", "--user", "reload", "prometheus"},
+		{"systemctl", "--user", "show", "--value", "--property=ExecMainStartTimestamp", "prometheus"},
+	}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("expected calls %v, got %v", expect, calls)
+	}
+}
@@ -0,0 +1,19 @@
+package osutil
+
+import "syscall"
+
+// Machine returns the hardware name of this host, as in uname -m. If that fails the empty string is returned.
+func Machine() string {
+	var u syscall.Utsname
+	if err := syscall.Uname(&u); err != nil {
+		return ""
+	}
+	b := make([]byte, 0, len(u.Machine))
+	for _, c := range u.Machine {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
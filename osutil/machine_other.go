@@ -0,0 +1,8 @@
+//go:build !linux
+
+package osutil
+
+import "runtime"
+
+// Machine returns the hardware name of this host, on non-Linux systems this is runtime.GOARCH.
+func Machine() string { return runtime.GOARCH }
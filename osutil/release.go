@@ -1,31 +1,124 @@
 package osutil
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 )
 
 var (
 	// this is a variable so it can be overridden during unit-testing.
-	osRelease = "/etc/os-release"
+	osRelease = []string{"/etc/os-release", "/usr/lib/os-release"}
 )
 
-// ID returns the ID of the system as specific in the osRelease file.
-func ID() string {
-	buf, err := os.ReadFile(osRelease)
-	if err != nil {
-		return ""
+// Release holds the identification of the operating system from os-release(5).
+type Release struct {
+	Name            string            // NAME, i.e. "Ubuntu".
+	ID              string            // ID, i.e. "ubuntu".
+	IDLike          []string          // ID_LIKE, closest relative first, i.e. ["debian"].
+	Version         string            // VERSION, i.e. "20.04.5 LTS (Focal Fossa)".
+	VersionID       string            // VERSION_ID, i.e. "20.04".
+	VersionCodename string            // VERSION_CODENAME, i.e. "focal".
+	PrettyName      string            // PRETTY_NAME, i.e. "Ubuntu 20.04.5 LTS".
+	Variant         string            // VARIANT, i.e. "Server".
+	VariantID       string            // VARIANT_ID, i.e. "server".
+	Fields          map[string]string // All fields, including the ones above.
+}
+
+// OSRelease parses the os-release file of the system. /etc/os-release is used, and /usr/lib/os-release when that
+// doesn't exist.
+func OSRelease() (Release, error) {
+	var err error
+	for _, file := range osRelease {
+		var f *os.File
+		f, err = os.Open(file)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		return ParseRelease(f)
+	}
+	return Release{}, err
+}
+
+// ParseRelease parses an os-release file from r. Values may be quoted with single or double quotes, inside double
+// quotes backslash escapes are used for '"', '\', '$' and '`'. Malformed lines are skipped.
+func ParseRelease(r io.Reader) (Release, error) {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		v, err := unquote(value)
+		if err != nil {
+			continue
+		}
+		fields[key] = v
 	}
-	i := bytes.Index(buf, []byte("\nID=")) // want ^ID=
-	if i == 0 {
-		return ""
+	if err := scanner.Err(); err != nil {
+		return Release{}, err
 	}
-	id := buf[i+len("\nID="):]
-	j := bytes.Index(id, []byte("\n"))
-	if j == 0 {
-		return ""
+	return Release{
+		Name:            fields["NAME"],
+		ID:              fields["ID"],
+		IDLike:          strings.Fields(fields["ID_LIKE"]),
+		Version:         fields["VERSION"],
+		VersionID:       fields["VERSION_ID"],
+		VersionCodename: fields["VERSION_CODENAME"],
+		PrettyName:      fields["PRETTY_NAME"],
+		Variant:         fields["VARIANT"],
+		VariantID:       fields["VARIANT_ID"],
+		Fields:          fields,
+	}, nil
+}
+
+// unquote returns the value of s, with quotes removed and escapes resolved.
+func unquote(s string) (string, error) {
+	if s == "" {
+		return "", nil
 	}
-	// Some attributes are quoted, some are not. Cover both.
-	id = bytes.ReplaceAll(id[:j], []byte("\""), []byte{})
-	return string(id)
+	switch s[0] {
+	case '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return "", fmt.Errorf("unterminated quote in %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case '"':
+		if len(s) < 2 || s[len(s)-1] != '"' {
+			return "", fmt.Errorf("unterminated quote in %s", s)
+		}
+		s = s[1 : len(s)-1]
+	default:
+		return s, nil
+	}
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`", s[i+1]) > -1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), nil
+}
+
+// ID returns the ID of the system as specified in the os-release file, or the empty string if it can't be read.
+func ID() string {
+	r, _ := OSRelease()
+	return r.ID
+}
+
+// IDLike returns the IDs of the systems this system is derived from, as specified in ID_LIKE in the os-release file.
+// The closest relative comes first.
+func IDLike() []string {
+	r, _ := OSRelease()
+	return r.IDLike
 }
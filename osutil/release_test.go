@@ -1,6 +1,7 @@
 package osutil
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -19,10 +20,90 @@ func TestID(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		osRelease = test.osReleaseFilePath
+		osRelease = []string{test.osReleaseFilePath}
 		actual := ID()
 		if test.expected != actual {
 			t.Fatalf("Expected: %q, got :%q", test.expected, actual)
 		}
 	}
 }
+
+func TestIDLike(t *testing.T) {
+	var tests = []struct {
+		osReleaseFilePath string
+		expected          []string
+	}{
+		{
+			osReleaseFilePath: "testdata/os-release-rhel77",
+			expected:          []string{"fedora"},
+		},
+		{
+			osReleaseFilePath: "testdata/os-release-ubuntu2004",
+			expected:          []string{"debian"},
+		},
+	}
+
+	for _, test := range tests {
+		osRelease = []string{test.osReleaseFilePath}
+		actual := IDLike()
+		if strings.Join(test.expected, " ") != strings.Join(actual, " ") {
+			t.Fatalf("Expected: %q, got :%q", test.expected, actual)
+		}
+	}
+}
+
+func TestParseRelease(t *testing.T) {
+	doc := "ID=alpine\n" +
+		"# a comment\n" +
+		"NAME=\"Alpine \\\"Edge\\\" Linux\"\n" +
+		"VERSION_ID='3.18'\n" +
+		"PRETTY_NAME=\"Costs \\$5 \\\\ \\` day\"\n" +
+		"\n" +
+		"ID_LIKE=\"rhel centos fedora\"\n"
+	r, err := ParseRelease(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != "alpine" {
+		t.Errorf("expected ID %q, got %q", "alpine", r.ID)
+	}
+	if r.Name != `Alpine "Edge" Linux` {
+		t.Errorf("expected NAME %q, got %q", `Alpine "Edge" Linux`, r.Name)
+	}
+	if r.VersionID != "3.18" {
+		t.Errorf("expected VERSION_ID %q, got %q", "3.18", r.VersionID)
+	}
+	if r.PrettyName != "Costs $5 \\ ` day" {
+		t.Errorf("expected PRETTY_NAME %q, got %q", "Costs $5 \\ ` day", r.PrettyName)
+	}
+	if strings.Join(r.IDLike, " ") != "rhel centos fedora" {
+		t.Errorf("expected ID_LIKE %q, got %q", "rhel centos fedora", r.IDLike)
+	}
+
+	r, err = ParseRelease(strings.NewReader("ID=\"alpine\nthis is not a field\nVERSION_ID=3.18\n"))
+	if err != nil {
+		t.Fatalf("expected malformed lines to be skipped, got %s", err)
+	}
+	if r.ID != "" || r.VersionID != "3.18" {
+		t.Errorf("expected only VERSION_ID %q, got ID %q and VERSION_ID %q", "3.18", r.ID, r.VersionID)
+	}
+}
+
+func TestOSReleaseFallback(t *testing.T) {
+	osRelease = []string{"testdata/does-not-exist", "testdata/os-release-ubuntu2004"}
+	r, err := OSRelease()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.VersionCodename != "focal" {
+		t.Errorf("expected VERSION_CODENAME %q, got %q", "focal", r.VersionCodename)
+	}
+
+	osRelease = []string{"testdata/does-not-exist"}
+	if _, err := OSRelease(); err == nil {
+		t.Errorf("expected error for missing os-release")
+	}
+	if id := ID(); id != "" {
+		t.Errorf("expected empty ID, got %q", id)
+	}
+}
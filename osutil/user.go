@@ -1,17 +1,60 @@
 package osutil
 
 import (
+	"fmt"
+	"os"
 	"os/user"
 	"strconv"
 )
 
-// User looks up the username u and return the uid and gid. If the username can't be found 0, 0 is returned.
-func User(u string) (int64, int64) {
-	u1, err := user.Lookup(u)
-	if err != nil {
-		return 0, 0
+// User looks up the user u and group g and returns the uid and gid. Both may be names or numeric ids. If g is empty
+// the primary group of u is used. A numeric uid without a passwd entry needs g to be set. If u is empty the uid and
+// gid of the current process are returned. An error is returned when the user or group can't be found.
+func User(u, g string) (int64, int64, error) {
+	if u == "" && g == "" {
+		return int64(os.Getuid()), int64(os.Getgid()), nil
 	}
-	uid, _ := strconv.ParseInt(u1.Uid, 10, 32)
-	gid, _ := strconv.ParseInt(u1.Gid, 10, 32)
-	return uid, gid
+
+	uid, gid := int64(os.Getuid()), int64(-1)
+	if u != "" {
+		u1, err := lookupUser(u)
+		switch {
+		case err == nil:
+			uid, _ = strconv.ParseInt(u1.Uid, 10, 32)
+			gid, _ = strconv.ParseInt(u1.Gid, 10, 32)
+		case isNumeric(u):
+			uid, _ = strconv.ParseInt(u, 10, 32)
+		default:
+			return 0, 0, fmt.Errorf("unknown user %q", u)
+		}
+	}
+
+	switch {
+	case g == "" && gid == -1:
+		return 0, 0, fmt.Errorf("uid %q has no passwd entry, a group must be set", u)
+	case g == "":
+	case isNumeric(g):
+		gid, _ = strconv.ParseInt(g, 10, 32)
+	default:
+		g1, err := user.LookupGroup(g)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unknown group %q", g)
+		}
+		gid, _ = strconv.ParseInt(g1.Gid, 10, 32)
+	}
+	return uid, gid, nil
+}
+
+// lookupUser looks up u by name, or by uid when u is numeric.
+func lookupUser(u string) (*user.User, error) {
+	if isNumeric(u) {
+		return user.LookupId(u)
+	}
+	return user.Lookup(u)
+}
+
+// isNumeric returns true if s is a valid numeric id.
+func isNumeric(s string) bool {
+	i, err := strconv.ParseInt(s, 10, 32)
+	return err == nil && i >= 0
 }
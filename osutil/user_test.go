@@ -0,0 +1,41 @@
+package osutil
+
+import (
+	"os"
+	"testing"
+)
+
+func TestUser(t *testing.T) {
+	var tests = []struct {
+		user, group string
+		uid, gid    int64
+		err         bool
+	}{
+		{"", "", int64(os.Getuid()), int64(os.Getgid()), false},
+		{"root", "", 0, 0, false},
+		{"0", "", 0, 0, false},
+		{"root", "12345", 0, 12345, false},
+		{"54321", "12345", 54321, 12345, false},
+		{"", "12345", int64(os.Getuid()), 12345, false},
+		{"54321", "", 0, 0, true},
+		{"promtheus-does-not-exist", "", 0, 0, true},
+		{"root", "promtheus-does-not-exist", 0, 0, true},
+	}
+
+	for _, test := range tests {
+		uid, gid, err := User(test.user, test.group)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error for user %q, group %q", test.user, test.group)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected no error for user %q, group %q, got %s", test.user, test.group, err)
+			continue
+		}
+		if uid != test.uid || gid != test.gid {
+			t.Errorf("expected %d:%d for user %q, group %q, got %d:%d", test.uid, test.gid, test.user, test.group, uid, gid)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miekg/gitopper/ospkg"
+	"go.science.ru.nl/log"
+)
+
+// upgradeInterval is the time between checks for pending package upgrades.
+const upgradeInterval = time.Hour
+
+// reconcile makes the packages on the system match the packages of s: missing packages or packages with a version that
+// doesn't match are installed and, if RemovePackages is true, packages installed for s that are no longer in the
+// config are removed. All package operations are recorded in the history of s. The first error is returned.
+func (s *Service) reconcile() error {
+	names := []string{}
+	for _, p := range s.packages() {
+		name, _ := ospkg.Split(p)
+		names = append(names, name)
+
+		installed, err := ospkg.Ensure(s.pkg, p, s.Hold)
+		if installed {
+			version, _ := s.pkg.Installed(name)
+			s.Record("installed package %q, version %s", name, version)
+		}
+		if errors.Is(err, ospkg.ErrHold) {
+			log.Warningf("Service %q, not holding package %q: %s", s.Service, p, err)
+			continue
+		}
+		if err != nil {
+			s.Record("error installing package %q: %s", p, err)
+			return fmt.Errorf("installing package %q: %s", p, err)
+		}
+	}
+
+	s.mu.RLock()
+	previous := s.installed
+	s.mu.RUnlock()
+	for _, name := range previous {
+		if contains(names, name) || !s.RemovePackages {
+			continue
+		}
+		if err := s.pkg.Remove(name); err != nil {
+			s.Record("error removing package %q: %s", name, err)
+			return fmt.Errorf("removing package %q: %s", name, err)
+		}
+		s.Record("removed package %q", name)
+	}
+
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.installed = names
+	s.save()
+	return nil
+}
+
+// upgrades sets the metric with the number of packages of s that have a pending upgrade.
+func (s *Service) upgrades() {
+	n := 0
+	for _, p := range s.packages() {
+		name, _ := ospkg.Split(p)
+		if s.pkg.Upgradable(name) {
+			log.Infof("Service %q, package %q has a pending upgrade", s.Service, name)
+			n++
+		}
+	}
+	metricServiceUpgrades.WithLabelValues(s.Service).Set(float64(n))
+}
+
+// trackUpgrades checks for pending package upgrades every upgradeInterval.
+func (s *Service) trackUpgrades(ctx context.Context) {
+	for {
+		s.upgrades()
+		select {
+		case <-time.After(upgradeInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.science.ru.nl/log"
+)
+
+// fakeInstaller is an ospkg.Installer that keeps the installed packages in memory.
+type fakeInstaller struct {
+	installed map[string]string // name -> version
+	err       error
+}
+
+func (f *fakeInstaller) Install(pkg string) error {
+	if f.err != nil {
+		return f.err
+	}
+	name, version, _ := strings.Cut(pkg, "=")
+	f.installed[name] = version
+	return nil
+}
+
+func (f *fakeInstaller) Installed(pkg string) (string, bool) {
+	v, ok := f.installed[pkg]
+	return v, ok
+}
+
+func (f *fakeInstaller) Hold(pkg string) error { return nil }
+
+func (f *fakeInstaller) Remove(pkg string) error {
+	delete(f.installed, pkg)
+	return nil
+}
+
+func (f *fakeInstaller) Upgradable(pkg string) bool { return false }
+
+func TestReconcile(t *testing.T) {
+	log.Discard()
+	mount := t.TempDir()
+	fake := &fakeInstaller{installed: map[string]string{}}
+	s := &Service{Service: "prometheus", Mount: mount, Packages: []string{"prometheus=2.45.0", "promtool"}, RemovePackages: true, pkg: fake}
+	if err := s.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.installed["promtool"]; !ok {
+		t.Errorf("expected package %q to be installed", "promtool")
+	}
+
+	// restart with a new version of prometheus and without promtool.
+	s = &Service{Service: "prometheus", Mount: mount, Packages: []string{"prometheus=2.46.0"}, RemovePackages: true, pkg: fake}
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if v := fake.installed["prometheus"]; v != "2.46.0" {
+		t.Errorf("expected version %q of package %q, got %q", "2.46.0", "prometheus", v)
+	}
+	if _, ok := fake.installed["promtool"]; ok {
+		t.Errorf("expected package %q to be removed", "promtool")
+	}
+
+	history := []string{}
+	for _, e := range s.History() {
+		history = append(history, e.Message)
+	}
+	expected := []string{
+		`installed package "prometheus", version 2.45.0`,
+		`installed package "promtool", version `,
+		`installed package "prometheus", version 2.46.0`,
+		`removed package "promtool"`,
+	}
+	if !reflect.DeepEqual(history, expected) {
+		t.Errorf("expected history %q, got %q", expected, history)
+	}
+
+	fake.err = fmt.Errorf("no space left on device")
+	s.Packages = []string{"grafana"}
+	if err := s.reconcile(); err == nil {
+		t.Errorf("expected error installing package %q", "grafana")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	log.Discard()
+	s := &Service{Service: "prometheus", Mount: t.TempDir()}
+	s.SetState(StateOK, "")
+	s.SetState(StateBroken, "error starting service")
+	s.SetState(StateBroken, "error starting service")
+	for i := 0; i < maxHistory; i++ {
+		s.Record("event %d", i)
+	}
+
+	s1 := &Service{Service: "prometheus", Mount: s.Mount}
+	if err := s1.load(); err != nil {
+		t.Fatal(err)
+	}
+	history := s1.History()
+	if len(history) != maxHistory {
+		t.Fatalf("expected %d events, got %d", maxHistory, len(history))
+	}
+	if history[0].Message != "event 0" {
+		t.Errorf("expected oldest event to be %q, got %q", "event 0", history[0].Message)
+	}
+}
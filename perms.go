@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/miekg/gitopper/osutil"
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// Perm is the ownership and mode of files and directories. Empty fields are left alone.
+type Perm struct {
+	Path     string // Glob pattern of the paths this applies to, relative to the dir. Only used in manifests.
+	Owner    string // Owner, a name or a numeric uid.
+	Group    string // Group, a name or a numeric gid.
+	FileMode string `toml:"file_mode"` // Mode of files, in octal, i.e. "0640".
+	DirMode  string `toml:"dir_mode"`  // Mode of directories, in octal, i.e. "0750".
+}
+
+// Manifest holds the permissions for paths in a dir, the last matching Perm wins.
+type Manifest struct {
+	Files []Perm
+}
+
+// perm returns the permissions set on d itself.
+func (d Dir) perm() Perm {
+	return Perm{Owner: d.Owner, Group: d.Group, FileMode: d.FileMode, DirMode: d.DirMode}
+}
+
+// hasPerms returns true if d sets any permissions.
+func (d Dir) hasPerms() bool { return d.perm() != Perm{} || d.Manifest != "" }
+
+// valid returns an error if the modes of p can't be parsed.
+func (p Perm) valid() error {
+	if _, err := parseMode(p.FileMode); err != nil {
+		return fmt.Errorf("invalid file mode %q: %s", p.FileMode, err)
+	}
+	if _, err := parseMode(p.DirMode); err != nil {
+		return fmt.Errorf("invalid dir mode %q: %s", p.DirMode, err)
+	}
+	if p.Path != "" {
+		if _, err := path.Match(p.Path, ""); err != nil {
+			return fmt.Errorf("invalid path %q: %s", p.Path, err)
+		}
+	}
+	return nil
+}
+
+// writable returns an error if p takes write access to the git repo away from user, as git runs as user and must be
+// able to update the files. An empty user means git runs as root, which can always write.
+func (p Perm) writable(user string) error {
+	if user == "" {
+		return nil
+	}
+	if p.Owner != "" && p.Owner != user {
+		return fmt.Errorf("owner %q, but git runs as user %q", p.Owner, user)
+	}
+	if m, _ := parseMode(p.FileMode); m != 0 && m&0600 != 0600 {
+		return fmt.Errorf("file mode %q, but user %q must be able to read and write files", p.FileMode, user)
+	}
+	if m, _ := parseMode(p.DirMode); m != 0 && m&0700 != 0700 {
+		return fmt.Errorf("dir mode %q, but user %q must be able to list and write directories", p.DirMode, user)
+	}
+	return nil
+}
+
+// merge returns p with the non-empty fields of q.
+func (p Perm) merge(q Perm) Perm {
+	if q.Owner != "" {
+		p.Owner = q.Owner
+	}
+	if q.Group != "" {
+		p.Group = q.Group
+	}
+	if q.FileMode != "" {
+		p.FileMode = q.FileMode
+	}
+	if q.DirMode != "" {
+		p.DirMode = q.DirMode
+	}
+	return p
+}
+
+// match returns true if p applies to rel. A pattern without a slash is also matched against the base name of rel.
+func (p Perm) match(rel string) bool {
+	if ok, _ := path.Match(p.Path, rel); ok {
+		return true
+	}
+	if strings.Contains(p.Path, "/") {
+		return false
+	}
+	ok, _ := path.Match(p.Path, path.Base(rel))
+	return ok
+}
+
+// parseMode parses the octal mode m, an empty m returns 0.
+func parseMode(m string) (fs.FileMode, error) {
+	if m == "" {
+		return 0, nil
+	}
+	i, err := strconv.ParseUint(m, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if i > 0777 {
+		return 0, fmt.Errorf("mode should be at most 0777")
+	}
+	return fs.FileMode(i), nil
+}
+
+// readManifest reads the manifest file.
+func readManifest(file string) (Manifest, error) {
+	m := Manifest{}
+	doc, err := os.ReadFile(file)
+	if err != nil {
+		return m, err
+	}
+	t := toml.NewDecoder(bytes.NewReader(doc))
+	t.DisallowUnknownFields()
+	if err := t.Decode(&m); err != nil {
+		return m, fmt.Errorf("failed to parse manifest %q: %s", file, err)
+	}
+	for _, p := range m.Files {
+		if err := p.valid(); err != nil {
+			return m, fmt.Errorf("manifest %q: %s", file, err)
+		}
+	}
+	return m, nil
+}
+
+// perms applies the permissions of the dirs of s to the files in the git repo, as the repo is the source for all
+// the ways files are deployed (bind mounts, symlinks, copies and rendered templates). Ownership is only changed when
+// we are root. Git ignores the modes of files in the repo (core.fileMode is false), so a changed mode isn't seen as a
+// local change. The number of files and directories changed is returned.
+func (s *Service) perms() (int, error) {
+	changed := 0
+	for _, d := range s.Dirs {
+		if !d.hasPerms() {
+			continue
+		}
+		gitdir := path.Join(s.Mount, s.Service, d.Link)
+		if d.File {
+			ok, err := chperm(gitdir, d.perm())
+			if err != nil {
+				return changed, err
+			}
+			if ok {
+				changed++
+			}
+			continue
+		}
+
+		m := Manifest{}
+		if d.Manifest != "" {
+			var err error
+			if m, err = readManifest(path.Join(gitdir, d.Manifest)); err != nil {
+				return changed, err
+			}
+			for _, q := range m.Files {
+				if err := q.writable(s.User); err != nil {
+					return changed, fmt.Errorf("manifest %q, path %q has %s", d.Manifest, q.Path, err)
+				}
+			}
+		}
+		err := filepath.WalkDir(gitdir, func(p string, e fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if e.IsDir() && e.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if e.Type()&fs.ModeSymlink != 0 {
+				return nil
+			}
+			rel, err := filepath.Rel(gitdir, p)
+			if err != nil {
+				return err
+			}
+			perm := d.perm()
+			for _, q := range m.Files {
+				if rel != "." && q.match(rel) {
+					perm = perm.merge(q)
+				}
+			}
+			ok, err := chperm(p, perm)
+			if ok {
+				changed++
+			}
+			return err
+		})
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// chperm applies perm to the file or directory p. It returns true if anything was changed.
+func chperm(p string, perm Perm) (bool, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+
+	mode, _ := parseMode(perm.FileMode)
+	if info.IsDir() {
+		mode, _ = parseMode(perm.DirMode)
+	}
+	if mode != 0 && info.Mode().Perm() != mode {
+		if err := os.Chmod(p, mode); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	if os.Geteuid() != 0 || (perm.Owner == "" && perm.Group == "") {
+		return changed, nil
+	}
+	uid, gid, err := osutil.User(perm.Owner, perm.Group)
+	if err != nil {
+		return changed, fmt.Errorf("failed to chown %q: %s", p, err)
+	}
+	if perm.Owner == "" {
+		uid = -1
+	}
+	if perm.Group == "" {
+		gid = -1
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if ok && (uid == -1 || int64(st.Uid) == uid) && (gid == -1 || int64(st.Gid) == gid) {
+		return changed, nil
+	}
+	if err := os.Lchown(p, int(uid), int(gid)); err != nil {
+		return changed, fmt.Errorf("failed to chown %q: %s", p, err)
+	}
+	return true, nil
+}
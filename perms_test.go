@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"go.science.ru.nl/log"
+)
+
+func TestPerms(t *testing.T) {
+	log.Discard()
+	mount := t.TempDir()
+	s := &Service{
+		Service: "prometheus",
+		Mount:   mount,
+		Dirs:    []Dir{{Link: "prometheus/etc", FileMode: "0640", DirMode: "0750", Manifest: "perms.toml"}},
+	}
+	gitdir := path.Join(mount, s.Service, "prometheus/etc")
+	os.MkdirAll(path.Join(gitdir, "rules"), 0755)
+	os.WriteFile(path.Join(gitdir, "prometheus.yml"), []byte("global:"), 0644)
+	os.WriteFile(path.Join(gitdir, "rules", "alerts.yml"), []byte("groups:"), 0644)
+	os.WriteFile(path.Join(gitdir, "rules", "run.sh"), []byte("#!/bin/sh"), 0755)
+	os.WriteFile(path.Join(gitdir, "perms.toml"), []byte(`
+[[files]]
+path = "rules/*.yml"
+file_mode = "0600"
+
+[[files]]
+path = "*.sh"
+file_mode = "0750"
+`), 0644)
+
+	changed, err := s.perms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the dir itself, rules, prometheus.yml, alerts.yml, run.sh and perms.toml
+	if changed != 6 {
+		t.Errorf("expected %d changes, got %d", 6, changed)
+	}
+	for p, mode := range map[string]os.FileMode{
+		".":                0750,
+		"rules":            0750,
+		"prometheus.yml":   0640,
+		"rules/alerts.yml": 0600,
+		"rules/run.sh":     0750,
+	} {
+		info, err := os.Stat(path.Join(gitdir, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("expected %q to have mode %o, got %o", p, mode, info.Mode().Perm())
+		}
+	}
+
+	if changed, _ := s.perms(); changed != 0 {
+		t.Errorf("expected %d changes, got %d", 0, changed)
+	}
+
+	os.WriteFile(path.Join(gitdir, "perms.toml"), []byte("[[files]]\npath = \"*.yml\"\nfile_mode = \"0999\"\n"), 0644)
+	if _, err := s.perms(); err == nil {
+		t.Errorf("expected error for invalid mode in manifest")
+	}
+}
+
+func TestPermWritable(t *testing.T) {
+	for i, tc := range []struct {
+		perm Perm
+		user string
+		err  bool
+	}{
+		{Perm{Owner: "root", FileMode: "0400"}, "", false},
+		{Perm{Owner: "prometheus", Group: "root", FileMode: "0640", DirMode: "0750"}, "prometheus", false},
+		{Perm{Owner: "root", DirMode: "0750"}, "prometheus", true},
+		{Perm{FileMode: "0440"}, "prometheus", true},
+		{Perm{DirMode: "0550"}, "prometheus", true},
+	} {
+		err := tc.perm.writable(tc.user)
+		if tc.err && err == nil {
+			t.Errorf("test %d, expected error, got none", i)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("test %d, expected no error, got %s", i, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"time"
+
+	"github.com/miekg/gitopper/gitcmd"
+)
+
+// Pin pins a service to another ref than its branch, i.e. to test a feature branch on a single machine.
+type Pin struct {
+	Ref   string    `json:"ref"`             // Branch in upstream, or anything git resolves to a commit.
+	Until time.Time `json:"until,omitempty"` // When the pin expires, zero if it doesn't.
+}
+
+// expired returns true if p has expired at now.
+func (p *Pin) expired(now time.Time) bool { return !p.Until.IsZero() && now.After(p.Until) }
+
+// Pin returns the pin of s, or nil if s isn't pinned.
+func (s *Service) Pin() *Pin {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.pin == nil {
+		return nil
+	}
+	p := *s.pin
+	return &p
+}
+
+// SetPin pins s to ref, if ttl is not zero the pin expires after ttl. Pinning s to its own branch removes the pin. The
+// pin and its event are saved together, with a single write of the state file.
+func (s *Service) SetPin(ref string, ttl time.Duration) {
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ref == s.Branch {
+		s.pin = nil
+		s.record("unpinned, back to %q", s.Branch)
+		return
+	}
+	s.pin = &Pin{Ref: ref}
+	if ttl <= 0 {
+		s.record("pinned to %q", ref)
+		return
+	}
+	s.pin.Until = time.Now().UTC().Add(ttl)
+	s.record("pinned to %q until %s", ref, s.pin.Until.Format(time.RFC1123))
+}
+
+// unpin removes the pin of s when it has expired.
+func (s *Service) unpin(now time.Time) {
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pin == nil || !s.pin.expired(now) {
+		return
+	}
+	ref := s.pin.Ref
+	s.pin = nil
+	s.record("pin to %q expired, back to %q", ref, s.Branch)
+}
+
+// pinned returns the ref s is pinned to and when that expires, or the empty string if s isn't pinned.
+func (s *Service) pinned() string {
+	p := s.Pin()
+	switch {
+	case p == nil:
+		return ""
+	case p.Until.IsZero():
+		return p.Ref
+	}
+	return p.Ref + " until " + p.Until.Format(time.RFC1123)
+}
+
+// ref returns the ref s should track: the ref it is pinned to, or its branch.
+func (s *Service) ref() string {
+	if p := s.Pin(); p != nil {
+		return p.Ref
+	}
+	return s.Branch
+}
+
+// checkout switches the git repo of s to the ref it should track, an expired pin is removed first. It returns true
+// if the checked out commit changed.
+func (s *Service) checkout(gc *gitcmd.Git) (bool, error) {
+	s.unpin(time.Now())
+	ref := s.ref()
+	if ref == gc.Ref() {
+		return false, nil
+	}
+	changed, err := gc.Switch(ref)
+	if err != nil {
+		return false, err
+	}
+	s.Record("checked out %q", ref)
+	return changed, nil
+}
+
+// untilPin returns the time until the pin of s expires, or zero if s isn't pinned or the pin doesn't expire.
+func (s *Service) untilPin() time.Duration {
+	p := s.Pin()
+	if p == nil || p.Until.IsZero() {
+		return 0
+	}
+	if d := time.Until(p.Until); d > 0 {
+		return d
+	}
+	return time.Nanosecond
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/miekg/gitopper/ossvc"
+	"go.science.ru.nl/log"
+)
+
+func TestPin(t *testing.T) {
+	log.Discard()
+	upstream := newUpstream(t, map[string]string{"prometheus/etc/prometheus.yml": "v1"})
+	local := t.TempDir()
+	s := &Service{
+		Upstream: upstream,
+		Service:  "prometheus",
+		Mount:    t.TempDir(),
+		Action:   "reload",
+		Dirs:     []Dir{{Local: local, Link: "prometheus/etc", Mode: ModeCopy}},
+		mgr:      &ossvc.Fake{},
+	}
+	s = s.merge(Global{Service: &Service{}})
+	gc := s.newGitCmd()
+	if err := gc.Checkout(); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, upstream, "checkout", "-q", "-b", "feature")
+	commit(t, upstream, map[string]string{"prometheus/etc/prometheus.yml": "feature"})
+	file := path.Join(local, "prometheus.yml")
+
+	s.SetPin("feature", time.Hour)
+	s.update(gc, false)
+	if buf, _ := os.ReadFile(file); string(buf) != "feature" || gc.Ref() != "feature" {
+		t.Fatalf("expected %q from feature, got %q from %q", "feature", buf, gc.Ref())
+	}
+	if state, _ := s.State(); state != StateOK {
+		t.Errorf("expected state %s, got %s", StateOK, state)
+	}
+
+	// persisted across restarts
+	s1 := &Service{Service: "prometheus", Mount: s.Mount}
+	if err := s1.load(); err != nil {
+		t.Fatal(err)
+	}
+	if p := s1.Pin(); p == nil || p.Ref != "feature" || p.Until.IsZero() {
+		t.Errorf("expected persisted pin to feature, got %v", p)
+	}
+
+	// expire the pin, we should go back to main
+	s.mu.Lock()
+	s.pin.Until = time.Now().Add(-time.Minute)
+	s.mu.Unlock()
+	s.update(gc, false)
+	if buf, _ := os.ReadFile(file); string(buf) != "v1" || gc.Ref() != "main" || s.Pin() != nil {
+		t.Errorf("expected %q from main after the pin expired, got %q from %q", "v1", buf, gc.Ref())
+	}
+}
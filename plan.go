@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/miekg/gitopper/ospkg"
+	"github.com/miekg/gitopper/osutil"
+	"go.science.ru.nl/mountinfo"
+)
+
+// Plan is what gitopper would do for a service, see --dry-run.
+type Plan struct {
+	Service  string   `json:"service"`
+	Upstream string   `json:"upstream"`
+	Repo     string   `json:"repo"`
+	Clone    bool     `json:"clone"`
+	Pin      string   `json:"pin,omitempty"`
+	Packages []string `json:"packages,omitempty"`
+	Window   string   `json:"window,omitempty"`
+	Dirs     []string `json:"dirs,omitempty"`
+	Units    []string `json:"units,omitempty"`
+	Commits  []string `json:"commits,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// plan returns the plan for s. Apart from fetching from upstream (when the repo is already checked out) nothing is
+// changed on the system.
+func (s *Service) plan(rootless bool) Plan {
+	gc := s.newGitCmd()
+	p := Plan{Service: s.Service, Upstream: s.Upstream, Repo: gc.Repo(), Clone: !gc.IsCheckedOut(), Window: s.windowState()}
+	if !rootless {
+		for _, pkg := range s.packages() {
+			if s.pkg == nil || ospkg.Needed(s.pkg, pkg) {
+				p.Packages = append(p.Packages, pkg)
+			}
+		}
+		if _, _, err := osutil.User(s.User, s.Group); err != nil && len(p.Packages) == 0 {
+			// packages may create the user, so only complain without them.
+			p.Error = fmt.Sprintf("error resolving user: %s", err)
+		}
+	}
+	if s.Pin() != nil {
+		p.Pin = s.ref()
+	}
+	if !p.Clone {
+		if p.Pin != "" {
+			gc.Track(p.Pin)
+		}
+		commits, err := gc.Incoming()
+		if err != nil {
+			p.Error = fmt.Sprintf("error fetching %q: %s", s.Upstream, err)
+		}
+		p.Commits = commits
+	}
+
+	deployed := false
+	for _, d := range s.Dirs {
+		if d.hasPerms() {
+			p.Dirs = append(p.Dirs, fmt.Sprintf("set permissions in %s", path.Join(gc.Repo(), d.Link)))
+		}
+		if d.Render {
+			p.Dirs = append(p.Dirs, fmt.Sprintf("render templates into %s", s.renderdir(d)))
+		}
+		if d.Local == "" {
+			continue
+		}
+		switch d.Mode {
+		case ModeCopy:
+			p.Dirs = append(p.Dirs, fmt.Sprintf("copy %s to %s", s.source(d), d.Local))
+			deployed = true
+			continue
+		case ModeSymlink:
+			p.Dirs = append(p.Dirs, fmt.Sprintf("symlink %s to %s", d.Local, s.source(d)))
+			deployed = true
+			continue
+		}
+
+		logtype := "directory"
+		if d.File {
+			logtype = "file"
+		}
+		if !exists(d.Local) {
+			p.Dirs = append(p.Dirs, fmt.Sprintf("create %s %s", logtype, d.Local))
+			if s.User != "" && s.Group != "" {
+				p.Dirs = append(p.Dirs, fmt.Sprintf("chown %s %s to %s:%s", logtype, d.Local, s.User, s.Group))
+			} else if s.User != "" {
+				p.Dirs = append(p.Dirs, fmt.Sprintf("chown %s %s to %s", logtype, d.Local, s.User))
+			}
+		}
+		if ok, err := mountinfo.Mounted(d.Local); err == nil && ok {
+			if !d.File {
+				continue
+			}
+			p.Dirs = append(p.Dirs, fmt.Sprintf("unmount %s", d.Local))
+		}
+		p.Dirs = append(p.Dirs, fmt.Sprintf("bind mount %s on %s", s.source(d), d.Local))
+		deployed = true
+	}
+	if s.Identity != "" {
+		p.Dirs = append(p.Dirs, fmt.Sprintf("decrypt secrets into %s", s.secretdir()))
+	}
+
+	if strings.Contains(s.Service, "@") {
+		p.Units = append(p.Units, fmt.Sprintf("enable %s", s.Service))
+	}
+	if deployed {
+		p.Units = append(p.Units, "reload service manager", fmt.Sprintf("start %s", s.Service))
+	}
+	if len(p.Commits) > 0 && s.Action != "" && p.Window != "closed" {
+		p.Units = append(p.Units, fmt.Sprintf("%s %s", s.Action, s.Service))
+	}
+	return p
+}
+
+// writePlans writes the plans to w, as JSON if js is true.
+func writePlans(w io.Writer, plans []Plan, js bool) error {
+	if js {
+		data, err := json.MarshalIndent(plans, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	for _, p := range plans {
+		fmt.Fprintf(w, "Service %q with upstream %q\n", p.Service, p.Upstream)
+		if p.Clone {
+			fmt.Fprintf(w, "  clone into %s\n", p.Repo)
+		}
+		if p.Pin != "" {
+			fmt.Fprintf(w, "  pinned to %s\n", p.Pin)
+		}
+		for _, pkg := range p.Packages {
+			fmt.Fprintf(w, "  install package %s\n", pkg)
+		}
+		for _, d := range p.Dirs {
+			fmt.Fprintf(w, "  %s\n", d)
+		}
+		for _, u := range p.Units {
+			fmt.Fprintf(w, "  %s\n", u)
+		}
+		if len(p.Commits) > 0 && p.Window == "closed" {
+			fmt.Fprintf(w, "  outside maintenance window, not merging:\n")
+		} else if len(p.Commits) > 0 {
+			fmt.Fprintf(w, "  merge into %s:\n", p.Repo)
+		}
+		for _, c := range p.Commits {
+			fmt.Fprintf(w, "    %s\n", c)
+		}
+		if p.Error != "" {
+			fmt.Fprintf(w, "  %s\n", p.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/gitopper/ossvc"
+	"go.science.ru.nl/log"
+)
+
+func TestPlan(t *testing.T) {
+	log.Discard()
+	upstream := newUpstream(t, map[string]string{"prometheus/etc/prometheus.yml": "v1"})
+	local := path.Join(t.TempDir(), "etc")
+	fake := &ossvc.Fake{}
+	s := &Service{
+		Upstream: upstream,
+		Service:  "prometheus",
+		Mount:    t.TempDir(),
+		Action:   "reload",
+		Package:  "prometheus",
+		Dirs:     []Dir{{Local: local, Link: "prometheus/etc", Mode: ModeCopy}},
+		mgr:      fake,
+	}
+	s = s.merge(Global{Service: &Service{}})
+
+	p := s.plan(false)
+	if !p.Clone {
+		t.Errorf("expected plan to clone %q", upstream)
+	}
+	if len(p.Packages) != 1 || p.Packages[0] != "prometheus" {
+		t.Errorf("expected plan to install package %q, got %v", "prometheus", p.Packages)
+	}
+	if exists(path.Join(s.Mount, s.Service)) {
+		t.Errorf("expected no checkout to be done")
+	}
+
+	if err := s.newGitCmd().Checkout(); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, upstream, map[string]string{"prometheus/etc/prometheus.yml": "v2"})
+	commit(t, upstream, map[string]string{"grafana/etc/grafana.ini": "v1"})
+
+	p = s.plan(true)
+	if len(p.Packages) != 0 {
+		t.Errorf("expected no packages in rootless mode, got %v", p.Packages)
+	}
+	if len(p.Commits) != 1 {
+		t.Errorf("expected %d incoming commit, got %d: %v", 1, len(p.Commits), p.Commits)
+	}
+	if len(p.Units) != 3 {
+		t.Errorf("expected reload, start and action, got %v", p.Units)
+	}
+	if exists(local) {
+		t.Errorf("expected %q not to be created", local)
+	}
+	if len(fake.Calls()) != 0 {
+		t.Errorf("expected no calls to the service manager, got %v", fake.Calls())
+	}
+}
+
+func TestPlanPackages(t *testing.T) {
+	log.Discard()
+	upstream := newUpstream(t, map[string]string{"prometheus/etc/prometheus.yml": "v1"})
+	fake := &fakeInstaller{installed: map[string]string{"prometheus": "2.45.0", "promtool": "2.44.0"}}
+	s := &Service{
+		Upstream: upstream,
+		Service:  "prometheus",
+		Mount:    t.TempDir(),
+		Packages: []string{"prometheus=2.45.*", "promtool=2.45.*", "node-exporter"},
+		pkg:      fake,
+	}
+	s = s.merge(Global{Service: &Service{}})
+
+	p := s.plan(false)
+	if !reflect.DeepEqual(p.Packages, []string{"promtool=2.45.*", "node-exporter"}) {
+		t.Errorf("expected plan to only install the needed packages, got %v", p.Packages)
+	}
+}
+
+func TestPlanPin(t *testing.T) {
+	log.Discard()
+	upstream := newUpstream(t, map[string]string{"prometheus/etc/prometheus.yml": "v1"})
+	s := &Service{
+		Upstream: upstream,
+		Service:  "prometheus",
+		Mount:    t.TempDir(),
+		Dirs:     []Dir{{Link: "prometheus/etc"}},
+	}
+	s = s.merge(Global{Service: &Service{}})
+	if err := s.newGitCmd().Checkout(); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, upstream, "checkout", "-q", "-b", "feature")
+	commit(t, upstream, map[string]string{"prometheus/etc/prometheus.yml": "v2"})
+
+	if p := s.plan(true); p.Pin != "" || len(p.Commits) != 0 {
+		t.Errorf("expected no pin and no incoming commits, got %q and %v", p.Pin, p.Commits)
+	}
+	s.SetPin("feature", 0)
+	p := s.plan(true)
+	if p.Pin != "feature" {
+		t.Errorf("expected plan to be pinned to %q, got %q", "feature", p.Pin)
+	}
+	if len(p.Commits) != 1 {
+		t.Errorf("expected %d incoming commit on the pinned branch, got %d: %v", 1, len(p.Commits), p.Commits)
+	}
+}
@@ -7,7 +7,7 @@ type (
 	}
 
 	ListMachine struct {
-		Machine string `json:"machine"` // Machine as set in config file.
+		Machine string `json:"machine"` // Machine (or glob pattern, or labels) as set in config file.
 		Actual  string `json:"actual"`  // Actual machine responding (i.e. -h flag might be used)
 	}
 
@@ -16,10 +16,36 @@ type (
 	}
 
 	ListService struct {
-		Service     string `json:"service"`
-		Hash        string `json:"hash"`
-		State       string `json:"state"`
-		StateInfo   string `json:"stateinfo"`
-		StateChange string `json:"change"`
+		Service     string   `json:"service"`
+		Hash        string   `json:"hash"`
+		State       string   `json:"state"`
+		StateInfo   string   `json:"stateinfo"`
+		StateChange string   `json:"change"`
+		Window      string   `json:"window"`          // Maintenance window: "open", "closed" or empty when none are defined.
+		Next        string   `json:"next"`            // When the next pull is scheduled.
+		Drift       []string `json:"drift,omitempty"` // Files with local changes.
+		Pin         string   `json:"pin,omitempty"`   // Ref the service is pinned to, and until when.
+	}
+
+	ListHistory struct {
+		Service string      `json:"service"`
+		History []ListEvent `json:"history"`
+	}
+
+	ListEvent struct {
+		Time    string `json:"time"`
+		Message string `json:"message"`
+	}
+
+	ListStashes struct {
+		Service string      `json:"service"`
+		Stashes []ListStash `json:"stashes"`
+	}
+
+	ListStash struct {
+		ID    string   `json:"id"`    // Hash of the stash, used to restore it.
+		Time  string   `json:"time"`  // When the stash was created.
+		Hash  string   `json:"hash"`  // Hash of the checkout when the stash was created.
+		Files []string `json:"files"` // Files in the stash.
 	}
 )
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/miekg/gitopper/osutil"
+)
+
+// Facts are the values available to templates.
+type Facts struct {
+	Hostname string            // Hostname of this host.
+	ID       string            // ID from os-release.
+	OS       osutil.Release    // All of os-release, i.e. .OS.VersionID or .OS.VersionCodename.
+	Machine  string            // Hardware name, as in uname -m.
+	Service  string            // Service the template is rendered for.
+	Vars     map[string]string // Vars from the service's configuration.
+}
+
+func (s *Service) facts() Facts {
+	release, _ := osutil.OSRelease()
+	return Facts{
+		Hostname: osutil.Hostname(),
+		ID:       release.ID,
+		OS:       release,
+		Machine:  osutil.Machine(),
+		Service:  s.Service,
+		Vars:     s.Vars,
+	}
+}
+
+// source returns the path that should be visible under d.Local, this is either the path in the git repo or the path
+// in the render directory.
+func (s *Service) source(d Dir) string {
+	if d.Render {
+		return s.renderdir(d)
+	}
+	return path.Join(s.Mount, s.Service, d.Link)
+}
+
+// renderdir returns the path where d will be rendered.
+func (s *Service) renderdir(d Dir) string {
+	p := path.Join(s.Mount, ".render", s.Service, d.Link)
+	if d.File {
+		return strings.TrimSuffix(p, ".tmpl")
+	}
+	return p
+}
+
+// render renders the templates of all dirs that have Render set. Files ending in .tmpl are executed with the facts of
+// s and written without the .tmpl suffix, other files are copied as-is.
+func (s *Service) render() error {
+	facts := s.facts()
+	conv := func(name string, data []byte) (string, []byte, error) {
+		if !strings.HasSuffix(name, ".tmpl") {
+			return name, data, nil
+		}
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return "", nil, err
+		}
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, facts); err != nil {
+			return "", nil, err
+		}
+		return strings.TrimSuffix(name, ".tmpl"), buf.Bytes(), nil
+	}
+
+	for _, d := range s.Dirs {
+		if !d.Render {
+			continue
+		}
+		if err := s.renderDir(d, conv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderDir renders the templates of a single dir d, using conv to convert the files.
+func (s *Service) renderDir(d Dir, conv convFunc) error {
+	// Render into a temporary directory first, so a failing template doesn't leave a half rendered tree.
+	if err := os.MkdirAll(path.Join(s.Mount, ".render"), 0775); err != nil {
+		return fmt.Errorf("failed to create directory %q: %s", path.Join(s.Mount, ".render"), err)
+	}
+	tmp, err := os.MkdirTemp(path.Join(s.Mount, ".render"), "."+s.Service+".")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	gitdir := path.Join(s.Mount, s.Service, d.Link)
+	if info, err := os.Stat(gitdir); err == nil && info.IsDir() { // MkdirTemp uses 0700, copy what git has
+		os.Chmod(tmp, info.Mode().Perm())
+		chownAs(tmp, info)
+	}
+	if d.File {
+		name, _, err := syncFile(gitdir, tmp, conv)
+		if err != nil {
+			return fmt.Errorf("failed to render %q: %s", gitdir, err)
+		}
+		if _, _, err := syncFile(path.Join(tmp, name), path.Dir(s.renderdir(d)), nil); err != nil {
+			return fmt.Errorf("failed to render %q: %s", gitdir, err)
+		}
+		return nil
+	}
+	if _, err := syncTree(gitdir, tmp, conv); err != nil {
+		return fmt.Errorf("failed to render %q: %s", gitdir, err)
+	}
+	if _, err := syncTree(tmp, s.renderdir(d), nil); err != nil {
+		return fmt.Errorf("failed to render %q: %s", gitdir, err)
+	}
+	return nil
+}
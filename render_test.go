@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/miekg/gitopper/osutil"
+)
+
+func TestRender(t *testing.T) {
+	mount := t.TempDir()
+	s := &Service{
+		Service: "test-service",
+		Mount:   mount,
+		Vars:    map[string]string{"port": "9090"},
+		Dirs:    []Dir{{Link: "prometheus/etc", Render: true}},
+	}
+	gitdir := path.Join(mount, s.Service, "prometheus/etc")
+	os.MkdirAll(gitdir, 0755)
+	os.WriteFile(path.Join(gitdir, "prometheus.yml.tmpl"), []byte("{{.Hostname}}:{{.Vars.port}}"), 0644)
+	os.WriteFile(path.Join(gitdir, "rules.yml"), []byte("rules"), 0644)
+
+	if err := s.render(); err != nil {
+		t.Fatalf("expected to render, got: %s", err)
+	}
+	out := s.renderdir(s.Dirs[0])
+	buf, err := os.ReadFile(path.Join(out, "prometheus.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := osutil.Hostname() + ":9090"; string(buf) != expect {
+		t.Errorf("expected rendered template to be %q, got %q", expect, buf)
+	}
+	if !exists(path.Join(out, "rules.yml")) {
+		t.Errorf("expected %q to be copied", "rules.yml")
+	}
+
+	os.Remove(path.Join(gitdir, "rules.yml"))
+	if err := s.render(); err != nil {
+		t.Fatalf("expected to render, got: %s", err)
+	}
+	if exists(path.Join(out, "rules.yml")) {
+		t.Errorf("expected %q to be removed", "rules.yml")
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	mount := t.TempDir()
+	s := &Service{
+		Service: "test-service",
+		Mount:   mount,
+		Dirs:    []Dir{{Link: "prometheus/etc", Render: true}},
+	}
+	gitdir := path.Join(mount, s.Service, "prometheus/etc")
+	os.MkdirAll(gitdir, 0755)
+	os.WriteFile(path.Join(gitdir, "prometheus.yml.tmpl"), []byte("{{.Vars.port}}"), 0644)
+
+	if err := s.render(); err == nil {
+		t.Fatalf("expected render error for missing variable, got none")
+	}
+}
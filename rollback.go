@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Special rollback targets, next to anything git can resolve to a commit.
+const (
+	RollbackPrevious = "previous"  // the commit deployed before the current one
+	RollbackLastGood = "last-good" // the last commit that was deployed successfully
+)
+
+// Previous returns the hash of the commit that was deployed before the current one.
+func (s *Service) Previous() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.previous
+}
+
+// LastGood returns the hash of the last commit that was deployed successfully: the service's files were deployed,
+// its action succeeded and it was set to OK.
+func (s *Service) LastGood() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastGood
+}
+
+// good marks hash as the last commit that was deployed successfully.
+func (s *Service) good(hash string) {
+	if hash == "" {
+		return
+	}
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastGood == hash {
+		return
+	}
+	s.lastGood = hash
+	s.save()
+}
+
+// resolve resolves the rollback target ref to the full hash of a commit in the git repo of s. Next to what git
+// understands, ref may be RollbackPrevious or RollbackLastGood.
+func (s *Service) resolve(ref string) (string, error) {
+	switch ref {
+	case RollbackPrevious:
+		if ref = s.Previous(); ref == "" {
+			return "", fmt.Errorf("no previous deploy")
+		}
+	case RollbackLastGood:
+		if ref = s.LastGood(); ref == "" {
+			return "", fmt.Errorf("no successful deploy")
+		}
+	}
+	return s.newGitCmd().Resolve(ref)
+}
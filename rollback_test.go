@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/miekg/gitopper/ossvc"
+	"go.science.ru.nl/log"
+)
+
+func TestRollback(t *testing.T) {
+	log.Discard()
+	fake := &ossvc.Fake{}
+	upstream := newUpstream(t, map[string]string{"prometheus/etc/prometheus.yml": "v1"})
+	s := &Service{
+		Upstream: upstream,
+		Service:  "prometheus",
+		Mount:    t.TempDir(),
+		Action:   "reload",
+		Dirs:     []Dir{{Local: t.TempDir(), Link: "prometheus/etc", Mode: ModeCopy}},
+		mgr:      fake,
+	}
+	s = s.merge(Global{Service: &Service{}})
+	gc := s.newGitCmd()
+	if err := gc.Checkout(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.resolve(RollbackPrevious); err == nil {
+		t.Errorf("expected error for %q without a previous deploy", RollbackPrevious)
+	}
+	s.SetHash(gc.Hash())
+	v1 := gc.Hash()
+
+	commit(t, upstream, map[string]string{"prometheus/etc/prometheus.yml": "v2"})
+	s.update(gc, false)
+	s.SetHash(gc.Hash())
+	v2 := gc.Hash()
+	if s.Previous() != v1 || s.LastGood() != v2 {
+		t.Fatalf("expected previous %s and last-good %s, got %s and %s", v1, v2, s.Previous(), s.LastGood())
+	}
+
+	// a deploy that fails, doesn't change last-good
+	fake.Err = errors.New("failed")
+	commit(t, upstream, map[string]string{"prometheus/etc/prometheus.yml": "v3"})
+	s.update(gc, false)
+	s.SetHash(gc.Hash())
+	if state, _ := s.State(); state != StateBroken || s.LastGood() != v2 {
+		t.Fatalf("expected state %s and last-good %s, got %s and %s", StateBroken, v2, state, s.LastGood())
+	}
+
+	hash, err := s.resolve(RollbackLastGood)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hash) != 40 || !strings.HasPrefix(hash, v2) {
+		t.Fatalf("expected full hash of %s, got %q", v2, hash)
+	}
+	if _, err := s.resolve("nosuchtag"); err == nil {
+		t.Errorf("expected error for unknown ref")
+	}
+
+	fake.Err = nil
+	s.SetState(StateRollback, hash)
+	s.update(gc, false)
+	s.SetHash(gc.Hash())
+	buf, _ := os.ReadFile(path.Join(gc.Repo(), "prometheus/etc/prometheus.yml"))
+	if state, info := s.State(); state != StateFreeze || info != "ROLLBACK: "+hash || string(buf) != "v2" {
+		t.Errorf("expected state %s with %q and %q, got %s with %q and %q", StateFreeze, "ROLLBACK: "+hash, "v2", state, info, buf)
+	}
+
+	// persisted across restarts
+	s1 := &Service{Service: "prometheus", Mount: s.Mount}
+	if err := s1.load(); err != nil {
+		t.Fatal(err)
+	}
+	if s1.Previous() != s.Previous() || s1.LastGood() != v2 {
+		t.Errorf("expected persisted previous %s and last-good %s, got %s and %s", s.Previous(), v2, s1.Previous(), s1.LastGood())
+	}
+}
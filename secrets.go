@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"filippo.io/age"
+	"github.com/miekg/gitopper/osutil"
+	"go.science.ru.nl/log"
+)
+
+const tmpfsMagic = 0x01021994
+
+// secretdir returns the directory where the secrets of s are decrypted to.
+func (s *Service) secretdir() string {
+	return path.Join(s.Secrets, s.Service)
+}
+
+// decrypt decrypts all files ending in .age in the dirs of s, with the identity from s.Identity. The decrypted files
+// are written (without the .age suffix) under the secret directory of s, only readable for s.User. If s has no
+// identity nothing is done.
+func (s *Service) decrypt() error {
+	if s.Identity == "" {
+		return nil
+	}
+	f, err := os.Open(s.Identity)
+	if err != nil {
+		return fmt.Errorf("failed to open identity: %s", err)
+	}
+	ids, err := age.ParseIdentities(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse identity %q: %s", s.Identity, err)
+	}
+
+	if err := os.MkdirAll(s.Secrets, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %q: %s", s.Secrets, err)
+	}
+	st := syscall.Statfs_t{}
+	if err := syscall.Statfs(s.Secrets, &st); err == nil && st.Type != tmpfsMagic {
+		log.Warningf("Service %q, secrets directory %q is not on tmpfs", s.Service, s.Secrets)
+	}
+
+	// Decrypt into a temporary directory first, so a failure doesn't leave half the secrets updated.
+	tmp, err := os.MkdirTemp(s.Secrets, "."+s.Service+".")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	uid, gid := -1, -1
+	if os.Geteuid() == 0 {
+		u, g, err := osutil.User(s.User, s.Group)
+		if err != nil {
+			return err
+		}
+		uid, gid = int(u), int(g)
+	}
+
+	decrypt := func(p string) error {
+		rel, err := filepath.Rel(path.Join(s.Mount, s.Service), p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		r, err := age.Decrypt(bytes.NewReader(data), ids...)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %q: %s", rel, err)
+		}
+		plain, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %q: %s", rel, err)
+		}
+		target := path.Join(tmp, strings.TrimSuffix(rel, ".age"))
+		if err := os.MkdirAll(path.Dir(target), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, plain, 0600); err != nil {
+			return err
+		}
+		return os.Chown(target, uid, gid)
+	}
+
+	for _, d := range s.Dirs {
+		gitdir := path.Join(s.Mount, s.Service, d.Link)
+		if d.File {
+			if strings.HasSuffix(gitdir, ".age") {
+				if err := decrypt(gitdir); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		err := filepath.WalkDir(gitdir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if d.IsDir() || !strings.HasSuffix(p, ".age") {
+				return nil
+			}
+			return decrypt(p)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	filepath.WalkDir(tmp, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			os.Chown(p, uid, gid)
+		}
+		return nil
+	})
+	_, err = syncTree(tmp, s.secretdir(), nil)
+	return err
+}
+
+// encrypt encrypts the files for the recipients in the recipients file, each file is written with an .age suffix.
+func encrypt(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: gitopper encrypt RECIPIENTS FILE...")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	recipients, err := age.ParseRecipients(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse recipients %q: %s", args[0], err)
+	}
+
+	for _, file := range args[1:] {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		buf := &bytes.Buffer{}
+		w, err := age.Encrypt(buf, recipients...)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file+".age", buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		log.Infof("Encrypted %q for %d recipients to %q", file, len(recipients), file+".age")
+	}
+	return nil
+}
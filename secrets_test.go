@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"filippo.io/age"
+	"go.science.ru.nl/log"
+)
+
+func TestDecrypt(t *testing.T) {
+	log.Discard()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mount := t.TempDir()
+	s := &Service{
+		Service:  "test-service",
+		Mount:    mount,
+		Identity: path.Join(mount, "identity.txt"),
+		Secrets:  path.Join(mount, "secrets"),
+		Dirs:     []Dir{{Link: "grafana/etc"}},
+	}
+	os.WriteFile(s.Identity, []byte(id.String()+"\n"), 0600)
+	os.WriteFile(path.Join(mount, "recipients.txt"), []byte(id.Recipient().String()+"\n"), 0644)
+
+	gitdir := path.Join(mount, s.Service, "grafana/etc")
+	os.MkdirAll(gitdir, 0755)
+	secret := path.Join(gitdir, "password")
+	os.WriteFile(secret, []byte("hunter2"), 0644)
+	if err := encrypt([]string{path.Join(mount, "recipients.txt"), secret}); err != nil {
+		t.Fatalf("expected to encrypt, got: %s", err)
+	}
+	os.Remove(secret)
+
+	if err := s.decrypt(); err != nil {
+		t.Fatalf("expected to decrypt, got: %s", err)
+	}
+	plain := path.Join(s.secretdir(), "grafana/etc/password")
+	buf, err := os.ReadFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hunter2" {
+		t.Errorf("expected decrypted secret to be %q, got %q", "hunter2", buf)
+	}
+	if info, _ := os.Stat(plain); info.Mode().Perm() != 0600 {
+		t.Errorf("expected decrypted secret to have mode %o, got %o", 0600, info.Mode().Perm())
+	}
+
+	// different identity, can't decrypt
+	other, _ := age.GenerateX25519Identity()
+	os.WriteFile(s.Identity, []byte(other.String()+"\n"), 0600)
+	if err := s.decrypt(); err == nil {
+		t.Fatalf("expected decryption to fail, got no error")
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"math/rand"
@@ -13,6 +12,8 @@ import (
 	"time"
 
 	"github.com/miekg/gitopper/gitcmd"
+	"github.com/miekg/gitopper/ospkg"
+	"github.com/miekg/gitopper/ossvc"
 	"github.com/miekg/gitopper/osutil"
 	"go.science.ru.nl/log"
 	"go.science.ru.nl/mountinfo"
@@ -20,31 +21,103 @@ import (
 
 // Service contains the service configuration tied to a specific machine.
 type Service struct {
-	Upstream string // The URL of the (upstream) Git repository.
-	Branch   string // The branch to track (defaults to 'main').
-	Service  string // Identifier for the service - will be used for action.
-	Machine  string // Identifier for this machine - may be shared with multiple machines.
-	Package  string // The package that might need installing.
-	User     string // what user to use for checking out the repo.
-	Action   string // The systemd action to take when files have changed.
-	Mount    string // Concatenated with server.Service this will be the directory where the git repo is checked out.
-	Dirs     []Dir  // How to map our local directories to the git repository.
-
-	pullNow chan struct{} // do an on demand pull
+	Upstream string            // The URL of the (upstream) Git repository.
+	Branch   string            // The branch to track (defaults to 'main').
+	Service  string            // Identifier for the service - will be used for action.
+	Machine  string            // Identifier for this machine - may be shared with multiple machines.
+	Machines []string          // Machines this service runs on, glob patterns or "@group" for groups defined in global.
+	Labels   map[string]string // Labels the host must have (see --labels) for this service to run on it.
+	Package  string            // The package that might need installing.
+	Packages []string          // Packages that might need installing, with optional version constraint, i.e. "prometheus=2.45.*".
+	Hold     bool              // If true, the packages are held, so the system won't upgrade them.
+	User     string            // what user to use for checking out the repo.
+	Group    string            // what group to use for checking out the repo, defaults to the primary group of user.
+	Action   string            // The action (i.e. systemctl <action>) to take when files have changed.
+	Mount    string            // Concatenated with server.Service this will be the directory where the git repo is checked out.
+	Cache    string            // Directory with a bare mirror per upstream, shared by all services using that upstream.
+	Interval Duration          // Time between pulls, defaults to the -t flag.
+	Dirs     []Dir             // How to map our local directories to the git repository.
+	Window   []Window          // Maintenance windows, outside of these updates are fetched, but not merged.
+	Vars     map[string]string // Variables available to templates.
+	Identity string            // The age identity file used to decrypt secrets.
+	Secrets  string            // Directory where secrets are decrypted to, should be on tmpfs (defaults to '/run/gitopper').
+	Scope    string            // Scope of the systemd unit: "system" (default) or "user".
+	Manager  string            // Service manager: "systemd", "openrc", "runit", "s6" or "signal", defaults to the system's.
+	Pidfile  string            // Pidfile of the process for the "signal" service manager.
+	Kind     string            // Kind of service: empty for a normal service or "compose" for a compose project.
+	Compose  string            // Binary used for compose: "docker" (default) or "podman".
+
+	DeployKey  string // SSH private key used to access upstream.
+	KnownHosts string // known_hosts file used to (strictly) check the host key of upstream.
+	TokenFile  string // File with the token used as password for HTTPS upstreams.
+	Drift      string // What to do with local changes in the git repo: "stash" (default), "reset" or "block".
+	Stashes    int    // Number of stashes with local changes to keep, defaults to 10, negative keeps all.
+
+	RemovePackages bool `toml:"remove_packages"` // If true, packages that are removed from the config are uninstalled.
+	CheckActive    bool `toml:"check_active"`    // If true, the service must be active after the action.
+
+	rootless bool                 // if true, we don't have root: don't bind mount or switch users
+	mgr      ossvc.ServiceManager // service manager to perform the action with
+	pkg      ospkg.Installer      // package installer for the packages
+
+	pullNow chan bool // do an on demand pull, if true, ignore any maintenance windows
+
+	file  string // included config file this service is defined in, empty for the main config file
+	index int    // index of this service in its config file
+
+	writeMu sync.Mutex // serializes writing the persisted state
+	written uint64     // version of the persisted state last written, protected by writeMu
 
 	mu         sync.RWMutex
 	state      State
 	stateInfo  string    // Extra info some states carry.
 	stateStamp time.Time // When did state change (UTC).
 	hash       string    // Git hash of the current git checkout.
+	next       time.Time // When is the next pull scheduled.
+	installed  []string  // Packages installed for this service, persisted.
+	dirty      bool      // Persisted state has changed, see save and flush.
+	saved      uint64    // Version of the persisted state, incremented by flush.
+	drift      []string  // Files with local changes in the git repo.
+	acked      bool      // Local changes are acknowledged, see Ack.
+	previous   string    // Git hash deployed before the current one, persisted.
+	lastGood   string    // Git hash of the last successful deploy, persisted.
+	pin        *Pin      // Ref other than Branch to track, persisted.
+	tracked    bool      // The tracking routine is running, see trackUpstream.
+	history    []Event   // State changes and package operations, persisted.
 }
 
 type Dir struct {
-	Local string // The directory on the local filesystem.
-	Link  string // The subdirectory inside the git repo to map to.
-	File  bool   // If true Local and Link are considered files.
+	Local  string // The directory on the local filesystem.
+	Link   string // The subdirectory inside the git repo to map to.
+	File   bool   // If true Local and Link are considered files.
+	Render bool   // If true files ending in .tmpl are rendered as templates, and the result is mounted under Local.
+	Mode   string // How Local is kept in sync with Link: "bind" (default), "copy" or "symlink".
+
+	Owner    string // Owner of the files, a name or a numeric uid.
+	Group    string // Group of the files, a name or a numeric gid.
+	FileMode string `toml:"file_mode"` // Mode of the files, in octal.
+	DirMode  string `toml:"dir_mode"`  // Mode of the directories, in octal.
+	Manifest string // Manifest file, relative to Link, with permissions for paths in Link.
 }
 
+// Scopes for a Service.
+const (
+	ScopeSystem = "system"
+	ScopeUser   = "user"
+)
+
+// Kinds of Service.
+const (
+	KindCompose = "compose"
+)
+
+// Deploy modes for a Dir.
+const (
+	ModeBind    = "bind"
+	ModeCopy    = "copy"
+	ModeSymlink = "symlink"
+)
+
 // Current State of a service.
 type State int
 
@@ -52,8 +125,9 @@ const (
 	StateOK       State = iota // The service is running as it should.
 	StateFreeze                // The service is locked to the current commit, no further updates are done.
 	StateRollback              // The service is rolled back and locked to that commit, no further updates are done.
-	StateBroken                // The service is broken, i.e. didn't start, systemctl error, etc.
+	StateBroken                // The service is broken, i.e. didn't start, service manager error, etc.
 	StateDiff                  // The service's git repo can't be reconciled with upstream for some reason.
+	StateDrift                 // The service's git repo has local changes and isn't pulled until these are acknowledged.
 )
 
 func (s State) String() string {
@@ -68,6 +142,8 @@ func (s State) String() string {
 		return "BROKEN"
 	case StateDiff:
 		return "DIFF"
+	case StateDrift:
+		return "DRIFT"
 	}
 	return ""
 }
@@ -80,8 +156,16 @@ func (s *Service) State() (State, string) {
 
 func (s *Service) SetState(st State, info string) {
 	log.Infof("Service %q, setting to state: %s:s", s.Service, st)
+	defer s.flush()
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if st != s.state || info != s.stateInfo {
+		if info == "" {
+			s.record("state %s", st)
+		} else {
+			s.record("state %s: %s", st, info)
+		}
+	}
 	s.stateStamp = time.Now().UTC()
 	s.state = st
 	s.stateInfo = info
@@ -97,8 +181,13 @@ func (s *Service) Hash() string {
 }
 
 func (s *Service) SetHash(h string) {
+	defer s.flush()
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.hash != "" && h != "" && h != s.hash {
+		s.previous = s.hash
+		s.save()
+	}
 	s.hash = h
 }
 
@@ -108,37 +197,140 @@ func (s *Service) Change() time.Time {
 	return s.stateStamp
 }
 
-func (s *Service) signalPullNow() {
-	s.pullNow <- struct{}{}
+// signalPullNow makes the tracking routine of s pull now, if force is true maintenance windows are ignored. If a pull
+// is already pending this is a no-op. An error is returned when s isn't being tracked.
+func (s *Service) signalPullNow(force bool) error {
+	s.mu.RLock()
+	tracked := s.tracked
+	s.mu.RUnlock()
+	if !tracked {
+		return fmt.Errorf("service %q is not being tracked", s.Service)
+	}
+	select {
+	case s.pullNow <- force:
+	default:
+	}
+	return nil
 }
 
 // merge merges anything defined in global into s when s doesn't specify it and returns the new Service.
 func (s *Service) merge(global Global) *Service {
+	s.defaults(global)
+	if s.mgr == nil {
+		s.mgr = s.newServiceManager()
+	}
+	// TODO: Examine whether replacing pullNow needs to occur with synchronization due to reads.
+	s.pullNow = make(chan bool, 1) // TODO(miek): newService would be a better place for time.
+	return s
+}
+
+// defaults sets the fields of s that are empty to the values from global, or to their default values.
+func (s *Service) defaults(global Global) {
 	if s.Upstream == "" {
 		s.Upstream = global.Upstream
 	}
 	if s.Mount == "" {
 		s.Mount = global.Mount
 	}
+	if s.Cache == "" {
+		s.Cache = global.Cache
+	}
+	if s.Interval.Duration == 0 {
+		s.Interval = global.Interval
+	}
+	if s.Drift == "" {
+		s.Drift = global.Drift
+	}
+	if s.Stashes == 0 {
+		s.Stashes = global.Stashes
+	}
+	if s.Stashes == 0 {
+		s.Stashes = 10
+	}
+	if s.DeployKey == "" {
+		s.DeployKey = global.DeployKey
+	}
+	if s.KnownHosts == "" {
+		s.KnownHosts = global.KnownHosts
+	}
+	if s.TokenFile == "" {
+		s.TokenFile = global.TokenFile
+	}
 	if s.Branch == "" {
 		s.Branch = global.Branch
 	}
 	if s.Branch == "" {
 		s.Branch = "main"
 	}
-	// TODO: Examine whether replacing pullNow needs to occur with synchronization due to reads.
-	s.pullNow = make(chan struct{}) // TODO(miek): newService would be a better place for time.
-	return s
+	if len(s.Window) == 0 {
+		s.Window = global.Window
+	}
+	if s.Identity == "" {
+		s.Identity = global.Identity
+	}
+	if s.Secrets == "" {
+		s.Secrets = global.Secrets
+	}
+	if s.Secrets == "" {
+		s.Secrets = "/run/gitopper"
+	}
+	if s.Manager == "" {
+		s.Manager = global.Manager
+	}
+	if s.Kind == KindCompose && s.Action == "" {
+		s.Action = "up"
+	}
 }
 
-// forMe compares the hostnames with the service machine name, it there is a match for service is for us.
-func (s *Service) forMe(hostnames []string) bool {
-	for _, h := range hostnames {
-		if h == s.Machine {
-			return true
-		}
+// packages returns the packages of s: package and packages.
+func (s *Service) packages() []string {
+	if s.Package == "" {
+		return s.Packages
+	}
+	return append([]string{s.Package}, s.Packages...)
+}
+
+// config returns a copy of the configuration of s, without any of the runtime state.
+func (s *Service) config() *Service {
+	return &Service{
+		Upstream: s.Upstream,
+		Branch:   s.Branch,
+		Service:  s.Service,
+		Machine:  s.Machine,
+		Machines: s.Machines,
+		Labels:   s.Labels,
+		Package:  s.Package,
+		Packages: s.Packages,
+		Hold:     s.Hold,
+		User:     s.User,
+		Group:    s.Group,
+		Action:   s.Action,
+		Mount:    s.Mount,
+		Cache:    s.Cache,
+		Interval: s.Interval,
+		Dirs:     append([]Dir(nil), s.Dirs...),
+		Window:   s.Window,
+		Vars:     s.Vars,
+		Identity: s.Identity,
+		Secrets:  s.Secrets,
+		Scope:    s.Scope,
+		Manager:  s.Manager,
+		Pidfile:  s.Pidfile,
+		Kind:     s.Kind,
+		Compose:  s.Compose,
+
+		DeployKey:  s.DeployKey,
+		KnownHosts: s.KnownHosts,
+		TokenFile:  s.TokenFile,
+		Drift:      s.Drift,
+		Stashes:    s.Stashes,
+
+		RemovePackages: s.RemovePackages,
+		CheckActive:    s.CheckActive,
+
+		file:  s.file,
+		index: s.index,
 	}
-	return false
 }
 
 func (s *Service) newGitCmd() *gitcmd.Git {
@@ -146,145 +338,296 @@ func (s *Service) newGitCmd() *gitcmd.Git {
 	for _, d := range s.Dirs {
 		dirs = append(dirs, d.Link)
 	}
-	return gitcmd.New(s.Upstream, s.Branch, path.Join(s.Mount, s.Service), s.User, dirs)
+	user, group := s.User, s.Group
+	if s.rootless { // we can't switch credentials
+		user, group = "", ""
+	}
+	gc := gitcmd.New(s.Upstream, s.Branch, path.Join(s.Mount, s.Service), user, dirs)
+	gc.SetGroup(group)
+	gc.SetMirror(s.Cache)
+	gc.SetCredentials(s.DeployKey, s.KnownHosts, s.TokenFile)
+	gc.SetKeepStashes(s.Stashes)
+	return gc
+}
+
+// setRootless prepares s to be run without root: dirs are copied instead of bind mounted and the systemd user
+// scope is used, unless set otherwise. Dirs that explicitly want a bind mount return an error.
+func (s *Service) setRootless() error {
+	s.rootless = true
+	if s.Scope == "" {
+		s.Scope = ScopeUser
+	}
+	for i := range s.Dirs {
+		switch s.Dirs[i].Mode {
+		case ModeBind:
+			return fmt.Errorf("dir %q can't be bind mounted without root", s.Dirs[i].Local)
+		case "":
+			s.Dirs[i].Mode = ModeCopy
+		}
+	}
+	return nil
 }
 
-// TrackUpstream does all the administration to track upstream and issue systemctl commands to keep the process
-// informed.
+// TrackUpstream does all the administration to track upstream and issue service manager commands to keep the
+// process informed.
 func (s *Service) trackUpstream(ctx context.Context, duration time.Duration) {
 	gc := s.newGitCmd()
 
 	log.Infof("Launched tracking routine for %q", s.Service)
+	s.setTracked(true)
+	defer s.setTracked(false)
 	s.SetHash(gc.Hash())
 	s.SetBoot()
 	state, info := s.State()
 	s.SetState(state, info)
 
+	if s.Interval.Duration > 0 {
+		duration = s.Interval.Duration
+	}
+	failures := 0
 	for {
 		s.SetHash(gc.Hash())
 
+		wait := jitter(backoff(duration, failures))
+		if d := s.untilPin(); d > 0 && d < wait { // revert an expired pin in time
+			wait = d
+		}
+		if failures > 0 {
+			log.Warningf("Service %q, failed to pull %d times, next pull in %s", s.Service, failures, wait)
+		}
+		s.SetNext(time.Now().Add(wait))
+
+		force := false
 		select {
-		case <-time.After(jitter(duration)):
-		case <-s.pullNow:
+		case <-time.After(wait):
+		case force = <-s.pullNow:
+			gc.FetchMirror()
 		case <-ctx.Done():
 			return
 		}
 
-		// this in now only done once... because we set state to broken... Should we keep trying??
-		if state == StateRollback && info != s.hash {
-			if err := gc.Rollback(info); err != nil {
-				log.Warningf("Service %q, error rollback repo %q to %q: %s", s.Service, s.Upstream, info, err)
-				s.SetState(StateDiff, fmt.Sprintf("error rolling back %q to %q: %s", s.Upstream, info, err))
-				continue
-			}
-			if _, err := s.bindmount(); err != nil {
-				log.Warningf("Service %q, error setting up bind mounts for %q: %s", s.Service, s.Upstream, err)
-				s.SetState(StateBroken, fmt.Sprintf("error setting up bind mounts repo %q: %s", s.Upstream, err))
-				continue
-			}
-			if rerr := s.reload(); rerr != nil {
-				log.Warningf("Service %q, error running systemctl daemon-reload: %s", s.Service, rerr)
-				s.SetState(StateBroken, fmt.Sprintf("error running systemctl daemon-reload %q: %s", s.Upstream, rerr))
-				continue
-			} else if err := s.systemctl(); err != nil {
-				log.Warningf("Service %q, error running systemctl: %s", s.Service, err)
-				s.SetState(StateBroken, fmt.Sprintf("error running systemctl %q: %s", s.Upstream, err))
-				continue
-			}
-			log.Warningf("Service %q, successfully rollback repo %q to %s", s.Service, s.Upstream, info)
-			s.SetState(StateFreeze, "ROLLBACK: "+info)
-			continue
+		if err := s.update(gc, force); err != nil {
+			failures++
+		} else {
+			failures = 0
 		}
+	}
+}
 
-		if state, _ := s.State(); state == StateFreeze || state == StateRollback {
-			log.Warningf("Service %q is in %s, not pulling", s.Service, state)
-			continue
+func (s *Service) setTracked(tracked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tracked = tracked
+}
+
+// update does a single round of tracking upstream: a pending rollback is performed, or upstream is pulled and the
+// action is taken when there are changes. If force is true maintenance windows are ignored. Only errors fetching or
+// pulling from upstream are returned, all other errors are reflected in the state of s.
+func (s *Service) update(gc *gitcmd.Git, force bool) error {
+	state, info := s.State()
+	// info holds the full hash, s.Hash() the abbreviated one.
+	if state == StateRollback && s.Hash() != "" && strings.HasPrefix(info, s.Hash()) {
+		s.SetState(StateFreeze, "ROLLBACK: "+info)
+		return nil
+	}
+	// this in now only done once... because we set state to broken... Should we keep trying??
+	if state == StateRollback {
+		if err := gc.Rollback(info); err != nil {
+			log.Warningf("Service %q, error rollback repo %q to %q: %s", s.Service, s.Upstream, info, err)
+			s.SetState(StateDiff, fmt.Sprintf("error rolling back %q to %q: %s", s.Upstream, info, err))
+			return nil
+		}
+		if _, err := s.perms(); err != nil {
+			log.Warningf("Service %q, error setting permissions for %q: %s", s.Service, s.Upstream, err)
+			s.SetState(StateBroken, fmt.Sprintf("error setting permissions repo %q: %s", s.Upstream, err))
+			return nil
+		}
+		if err := s.render(); err != nil {
+			log.Warningf("Service %q, error rendering templates for %q: %s", s.Service, s.Upstream, err)
+			s.SetState(StateBroken, fmt.Sprintf("error rendering templates repo %q: %s", s.Upstream, err))
+			return nil
+		}
+		if err := s.decrypt(); err != nil {
+			log.Warningf("Service %q, error decrypting secrets for %q: %s", s.Service, s.Upstream, err)
+			s.SetState(StateBroken, fmt.Sprintf("error decrypting secrets repo %q: %s", s.Upstream, err))
+			return nil
 		}
+		if _, err := s.deploy(); err != nil {
+			log.Warningf("Service %q, error deploying files for %q: %s", s.Service, s.Upstream, err)
+			s.SetState(StateBroken, fmt.Sprintf("error deploying files repo %q: %s", s.Upstream, err))
+			return nil
+		}
+		if rerr := s.reload(); rerr != nil {
+			log.Warningf("Service %q, error reloading service manager: %s", s.Service, rerr)
+			s.SetState(StateBroken, fmt.Sprintf("error reloading service manager %q: %s", s.Upstream, rerr))
+			return nil
+		} else if err := s.action(); err != nil {
+			log.Warningf("Service %q, error running action %q: %s", s.Service, s.Action, err)
+			s.SetState(StateBroken, fmt.Sprintf("error running action %q %q: %s", s.Action, s.Upstream, err))
+			return nil
+		}
+		log.Warningf("Service %q, successfully rollback repo %q to %s", s.Service, s.Upstream, info)
+		s.SetState(StateFreeze, "ROLLBACK: "+info)
+		return nil
+	}
+
+	if s.drifted(gc) {
+		return nil
+	}
+
+	if state, _ := s.State(); state == StateFreeze || state == StateRollback {
+		log.Warningf("Service %q is in %s, not pulling", s.Service, state)
+		return nil
+	}
+
+	// a checkout of another ref isn't held back by maintenance windows, it is asked for.
+	switched, err := s.checkout(gc)
+	if err != nil {
+		log.Warningf("Service %q, error checking out %q in repo %q: %s", s.Service, s.ref(), s.Upstream, err)
+		s.SetState(StateDiff, fmt.Sprintf("error checking out %q: %s", s.ref(), err))
+		return err
+	}
 
-		changed, err := gc.Pull()
+	if !switched && !force && !s.inWindow(time.Now()) {
+		pending, err := gc.Fetch()
+		if err != nil {
+			log.Warningf("Service %q, error fetching repo %q: %s", s.Service, s.Upstream, err)
+			s.SetState(StateDiff, fmt.Sprintf("error fetching %q: %s", s.Upstream, err))
+			return err
+		}
+		if state, _ := s.State(); state == StateOK && pending != "" {
+			log.Infof("Service %q is outside its maintenance window, not merging %s", s.Service, pending)
+			s.SetState(StateOK, "pending update "+pending)
+		}
+		return nil
+	}
+
+	changed := switched
+	if !switched {
+		changed, err = gc.Pull()
 		if err != nil {
 			log.Warningf("Service %q, error pulling repo %q: %s", s.Service, s.Upstream, err)
 			s.SetState(StateDiff, fmt.Sprintf("error pulling %q: %s", s.Upstream, err))
-			continue
+			return err
 		}
+	}
 
-		if !changed {
-			continue
-		}
+	if !changed {
+		return nil
+	}
 
-		s.SetHash(gc.Hash())
-		state, info = s.State()
-		s.SetState(state, info)
+	s.SetHash(gc.Hash())
+	state, info = s.State()
+	s.SetState(state, info)
 
-		if _, err := s.bindmount(); err != nil {
-			log.Warningf("Service %q, error setting up bind mounts for %q: %s", s.Service, s.Upstream, err)
-			s.SetState(StateBroken, fmt.Sprintf("error setting up bind mounts repo %q: %s", s.Upstream, err))
-			continue
-		}
-		log.Infof("Service %q, diff in repo %q, pinging it", s.Service, s.Upstream)
-		if rerr := s.reload(); rerr != nil {
-			log.Warningf("Service %q, error running systemctl daemon-reload: %s", s.Service, rerr)
-			s.SetState(StateBroken, fmt.Sprintf("error running systemctl daemon-reload %q: %s", s.Upstream, rerr))
-			continue
-		} else if err := s.systemctl(); err != nil {
-			log.Warningf("Service %q, error running systemctl: %s", s.Service, err)
-			s.SetState(StateBroken, fmt.Sprintf("error running systemctl %q: %s", s.Upstream, err))
-			continue
+	perms, err := s.perms()
+	if err != nil {
+		log.Warningf("Service %q, error setting permissions for %q: %s", s.Service, s.Upstream, err)
+		s.SetState(StateBroken, fmt.Sprintf("error setting permissions repo %q: %s", s.Upstream, err))
+		return nil
+	}
+	if err := s.render(); err != nil {
+		log.Warningf("Service %q, error rendering templates for %q: %s", s.Service, s.Upstream, err)
+		s.SetState(StateBroken, fmt.Sprintf("error rendering templates repo %q: %s", s.Upstream, err))
+		return nil
+	}
+	if err := s.decrypt(); err != nil {
+		log.Warningf("Service %q, error decrypting secrets for %q: %s", s.Service, s.Upstream, err)
+		s.SetState(StateBroken, fmt.Sprintf("error decrypting secrets repo %q: %s", s.Upstream, err))
+		return nil
+	}
+	changes, err := s.deploy()
+	if err != nil {
+		log.Warningf("Service %q, error deploying files for %q: %s", s.Service, s.Upstream, err)
+		s.SetState(StateBroken, fmt.Sprintf("error deploying files repo %q: %s", s.Upstream, err))
+		return nil
+	}
+	changes += perms
+	if changes == 0 && s.copied() {
+		log.Infof("Service %q, diff in repo %q, but no files changed", s.Service, s.Upstream)
+		if state, _ := s.State(); state == StateOK {
+			s.good(gc.Hash())
 		}
-		s.SetState(StateOK, "")
+		return nil
+	}
+	log.Infof("Service %q, diff in repo %q, pinging it", s.Service, s.Upstream)
+	if rerr := s.reload(); rerr != nil {
+		log.Warningf("Service %q, error reloading service manager: %s", s.Service, rerr)
+		s.SetState(StateBroken, fmt.Sprintf("error reloading service manager %q: %s", s.Upstream, rerr))
+		return nil
+	} else if err := s.action(); err != nil {
+		log.Warningf("Service %q, error running action %q: %s", s.Service, s.Action, err)
+		s.SetState(StateBroken, fmt.Sprintf("error running action %q %q: %s", s.Action, s.Upstream, err))
+		return nil
 	}
+	s.good(gc.Hash())
+	s.SetState(StateOK, "")
+	return nil
 }
 
-func (s *Service) reload() error {
-	ctx := context.TODO()
-	cmd := exec.CommandContext(ctx, "systemctl", "daemon-reload")
-	log.Infof("running %v", cmd.Args)
-	return cmd.Run()
+// newServiceManager returns the service manager for s.
+func (s *Service) newServiceManager() ossvc.ServiceManager {
+	if s.Kind == KindCompose {
+		return s.newCompose()
+	}
+	mgr := ossvc.New(s.Manager)
+	switch m := mgr.(type) {
+	case *ossvc.Systemd:
+		m.User = s.Scope == ScopeUser
+	case *ossvc.Signal:
+		m.Pidfile = s.Pidfile
+	}
+	return mgr
 }
 
-func (s *Service) systemctl() error {
-	if s.Action == "" {
-		return nil
+// newCompose returns the compose manager for s, the compose file (or directory) is the first of the dirs of s. Any
+// other dirs are deployed as usual, but not handed to compose.
+func (s *Service) newCompose() *ossvc.Compose {
+	c := &ossvc.Compose{Bin: s.Compose, Project: s.Service}
+	if len(s.Dirs) == 0 {
+		return c
 	}
-	ctx := context.TODO()
-	cmd := exec.CommandContext(ctx, "systemctl", s.Action, s.Service)
-	log.Infof("running %v", cmd.Args)
-	return cmd.Run()
+	d := s.Dirs[0]
+	p := d.Local
+	if p == "" {
+		p = s.source(d)
+	}
+	if d.File {
+		c.File = p
+	} else {
+		c.Dir = p
+	}
+	return c
 }
 
-func (s *Service) enable() error {
-	ctx := context.TODO()
-	cmd := exec.CommandContext(ctx, "systemctl", "enable", s.Service)
-	log.Infof("running %v", cmd.Args)
-	return cmd.Run()
-}
+func (s *Service) reload() error { return s.mgr.Reload() }
 
-func (s *Service) start() error {
-	ctx := context.TODO()
-	cmd := exec.CommandContext(ctx, "systemctl", "start", s.Service)
-	log.Infof("running %v", cmd.Args)
-	return cmd.Run()
-}
+func (s *Service) enable() error { return s.mgr.Enable(s.Service) }
 
-// Boot returns the start time of the service. If that isn't available because there isn't a Service in s, then we
-// return the kernel's boot time (i.e. when the system we started).
-func (s *Service) SetBoot() {
-	ctx := context.TODO()
-	cmd := &exec.Cmd{}
-	if s.Service != "" {
-		cmd = exec.CommandContext(ctx, "systemctl", "show", "--property=ExecMainStartTimestamp", s.Service)
-	} else {
-		cmd = exec.CommandContext(ctx, "systemctl", "show", "--property=KernelTimestamp")
+func (s *Service) start() error { return s.mgr.Start(s.Service) }
+
+// action performs the action of s. If CheckActive is true, or s is a compose project, an error is returned when the
+// service isn't active afterwards, unless the action stopped it.
+func (s *Service) action() error {
+	if s.Action == "" {
+		return nil
 	}
-	log.Infof("running %v", cmd.Args)
-	out, err := cmd.Output()
-	if err != nil {
-		return
+	if err := s.mgr.Action(s.Action, s.Service); err != nil {
+		return err
+	}
+	if s.Action == "stop" || (!s.CheckActive && s.Kind != KindCompose) {
+		return nil
+	}
+	if ok, err := s.mgr.IsActive(s.Service); err == nil && !ok {
+		return fmt.Errorf("service %q is not active after %s", s.Service, s.Action)
 	}
+	return nil
+}
 
-	out = bytes.TrimSpace(out)
-	// Testing show this is the string returned: Mon 2022-11-21 09:39:59 CET, so parse that into a time.Time
-	t, err := time.Parse("Mon 2006-01-02 15:04:05 MST", string(out))
+// SetBoot sets the state change time to the start time of the service. If that isn't available because there isn't
+// a Service in s, then we use the kernel's boot time (i.e. when the system we started).
+func (s *Service) SetBoot() {
+	t, err := s.mgr.StartTime(s.Service)
 	if err == nil { // on succes
 		s.mu.Lock()
 		defer s.mu.Unlock()
@@ -292,16 +635,39 @@ func (s *Service) SetBoot() {
 	}
 }
 
-// bindmount sets up the bind mount, the return integer returns how many mounts were performed.
-func (s *Service) bindmount() (int, error) {
+// deploy makes the files from the git repo available under Local for each of the dirs of s, by setting up a bind
+// mount (the default), copying the files or creating a symlink. The return integer returns how many dirs changed,
+// i.e. mounts performed, symlinks created or dirs with files copied.
+func (s *Service) deploy() (int, error) {
 	mounted := 0
 	for _, d := range s.Dirs {
 		if d.Local == "" {
 			continue
 		}
 
-		gitdir := path.Join(s.Mount, s.Service)
-		gitdir = path.Join(gitdir, d.Link)
+		switch d.Mode {
+		case ModeCopy:
+			n, err := s.copy(d)
+			if err != nil {
+				return 0, err
+			}
+			if n > 0 {
+				log.Infof("Copied %d changes to %q", n, d.Local)
+				mounted++
+			}
+			continue
+		case ModeSymlink:
+			ok, err := s.symlink(d)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				mounted++
+			}
+			continue
+		}
+
+		gitdir := s.source(d)
 
 		logtype := "Directory"
 		if d.File {
@@ -329,7 +695,10 @@ func (s *Service) bindmount() (int, error) {
 
 			}
 			if os.Geteuid() == 0 { // set d.Local to the correct owner, if we are root
-				uid, gid := osutil.User(s.User)
+				uid, gid, err := osutil.User(s.User, s.Group)
+				if err != nil {
+					return 0, fmt.Errorf("failed to chown %s %q: %s", strings.ToLower(logtype), d.Local, err)
+				}
 				if err := os.Chown(d.Local, int(uid), int(gid)); err != nil {
 					log.Errorf("%s %q can not be chown-ed to %q: %s", logtype, d.Local, s.User, err)
 					return 0, fmt.Errorf("failed to chown %s %q to %q: %s", strings.ToLower(logtype), d.Local, s.User, err)
@@ -397,7 +766,9 @@ func exists(p string) bool {
 
 // jitter will add a random amount of jitter [0, d/2] to d.
 func jitter(d time.Duration) time.Duration {
-	rand.Seed(time.Now().UnixNano())
 	max := d / 2
+	if max <= 0 {
+		return d
+	}
 	return d + time.Duration(rand.Int63n(int64(max)))
 }
@@ -27,7 +27,7 @@ func TestBindMounts(t *testing.T) {
 		}},
 	}
 
-	mounts, err := s.bindmount()
+	mounts, err := s.deploy()
 	if err != nil {
 		t.Fatal(err)
 	}
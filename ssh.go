@@ -1,10 +1,10 @@
 package main
 
 import (
-	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
@@ -39,7 +39,7 @@ func newRouter(c Config, hosts []string) ssh.Handler {
 		}
 		for prefix, f := range routes {
 			if strings.HasPrefix(s.Command()[0], prefix) {
-				if key.RO && strings.HasPrefix(s.Command()[0], "/state/") {
+				if key.RO && strings.HasPrefix(s.Command()[0], "/do/") {
 					log.Warningf("Key for user %q with public key %q is set RO and route is RW, denying", key.Path, s.User())
 					io.WriteString(s, http.StatusText(http.StatusUnauthorized))
 					s.Exit(http.StatusUnauthorized)
@@ -58,12 +58,17 @@ func newRouter(c Config, hosts []string) ssh.Handler {
 }
 
 var routes = map[string]func(Config, ssh.Session, []string){
-	"/list/machine": ListMachines,
-	"/list/service": ListService,
-	"/do/freeze":    FreezeService,
-	"/do/unfreeze":  UnfreezeService,
-	"/do/rollback":  RollbackService,
-	"/do/pull":      PullService,
+	"/list/machine":     ListMachines,
+	"/list/service":     ListService,
+	"/list/history":     ListHistory,
+	"/list/stash":       ListStash,
+	"/do/freeze":        FreezeService,
+	"/do/unfreeze":      UnfreezeService,
+	"/do/rollback":      RollbackService,
+	"/do/pull":          PullService,
+	"/do/ack":           AckService,
+	"/do/restore-stash": RestoreStashService,
+	"/do/checkout":      CheckoutService,
 }
 
 func writeAndExit(s ssh.Session, data []byte, err error) {
@@ -78,12 +83,19 @@ func writeAndExit(s ssh.Session, data []byte, err error) {
 
 func ListMachines(c Config, s ssh.Session, _ []string) {
 	lm := proto.ListMachines{
-		ListMachines: make([]proto.ListMachine, len(c.Services)),
+		ListMachines: []proto.ListMachine{},
 	}
-	for i, service := range c.Services {
-		lm.ListMachines[i] = proto.ListMachine{
-			Machine: service.Machine,
-			Actual:  osutil.Hostname(),
+	seen := map[string]struct{}{}
+	for _, service := range c.Services {
+		for _, m := range c.selectors(service) {
+			if _, ok := seen[m]; ok {
+				continue
+			}
+			seen[m] = struct{}{}
+			lm.ListMachines = append(lm.ListMachines, proto.ListMachine{
+				Machine: m,
+				Actual:  osutil.Hostname(),
+			})
 		}
 	}
 	data, err := json.Marshal(lm)
@@ -98,7 +110,7 @@ func ListService(c Config, s ssh.Session, hosts []string) {
 		target = s.Command()[1]
 	}
 	for _, service := range c.Services {
-		if !service.forMe(hosts) {
+		if !c.forMe(service, hosts) {
 			continue
 		}
 		state, info := service.State()
@@ -110,6 +122,10 @@ func ListService(c Config, s ssh.Session, hosts []string) {
 				State:       state.String(),
 				StateInfo:   info,
 				StateChange: service.Change().Format(time.RFC1123),
+				Window:      service.windowState(),
+				Next:        service.nextPull(),
+				Drift:       service.DriftFiles(),
+				Pin:         service.pinned(),
 			})
 		case target != "":
 			if service.Service == target {
@@ -119,6 +135,10 @@ func ListService(c Config, s ssh.Session, hosts []string) {
 					State:       state.String(),
 					StateInfo:   info,
 					StateChange: service.Change().Format(time.RFC1123),
+					Window:      service.windowState(),
+					Next:        service.nextPull(),
+					Drift:       service.DriftFiles(),
+					Pin:         service.pinned(),
 				})
 				break
 			}
@@ -133,6 +153,50 @@ func ListService(c Config, s ssh.Session, hosts []string) {
 	writeAndExit(s, data, err)
 }
 
+func ListHistory(c Config, s ssh.Session, hosts []string) {
+	if len(s.Command()) < 2 {
+		s.Exit(http.StatusNotAcceptable)
+		return
+	}
+	target := s.Command()[1]
+	for _, serv := range myServices(c, target, hosts) {
+		lh := proto.ListHistory{Service: serv.Service, History: []proto.ListEvent{}}
+		for _, e := range serv.History() {
+			lh.History = append(lh.History, proto.ListEvent{Time: e.Time.Format(time.RFC1123), Message: e.Message})
+		}
+		data, err := json.Marshal(lh)
+		writeAndExit(s, data, err)
+		return
+	}
+	io.WriteString(s, http.StatusText(http.StatusNotFound))
+	s.Exit(http.StatusNotFound)
+}
+
+func ListStash(c Config, s ssh.Session, hosts []string) {
+	if len(s.Command()) < 2 {
+		s.Exit(http.StatusNotAcceptable)
+		return
+	}
+	target := s.Command()[1]
+	for _, serv := range myServices(c, target, hosts) {
+		stashes, err := serv.StashList()
+		if err != nil {
+			log.Warningf("Machine %q, service %q, error listing stashes: %s", serv.Machine, serv.Service, err)
+			writeAndExit(s, nil, err)
+			return
+		}
+		ls := proto.ListStashes{Service: serv.Service, Stashes: []proto.ListStash{}}
+		for _, st := range stashes {
+			ls.Stashes = append(ls.Stashes, proto.ListStash{ID: st.ID, Time: st.Time.Format(time.RFC1123), Hash: st.Hash, Files: st.Files})
+		}
+		data, err := json.Marshal(ls)
+		writeAndExit(s, data, err)
+		return
+	}
+	io.WriteString(s, http.StatusText(http.StatusNotFound))
+	s.Exit(http.StatusNotFound)
+}
+
 func FreezeService(c Config, s ssh.Session, hosts []string) {
 	freezeStateService(c, s, StateFreeze, hosts)
 }
@@ -144,7 +208,7 @@ func UnfreezeService(c Config, s ssh.Session, hosts []string) {
 func myServices(c Config, target string, hosts []string) []*Service {
 	var s []*Service
 	for _, serv := range c.Services {
-		if serv.forMe(hosts) && serv.Service == target {
+		if c.forMe(serv, hosts) && serv.Service == target {
 			s = append(s, serv)
 		}
 	}
@@ -170,20 +234,22 @@ func freezeStateService(c Config, s ssh.Session, state State, hosts []string) {
 
 func RollbackService(c Config, s ssh.Session, hosts []string) {
 	if len(s.Command()) < 3 {
-		return
-	}
-	target := s.Command()[1]
-	hash := s.Command()[2]
-	if _, err := hex.DecodeString(hash); err != nil {
-		io.WriteString(s, http.StatusText(http.StatusNotAcceptable)+", not a valid hexadecimal git hash: "+hash)
 		s.Exit(http.StatusNotAcceptable)
 		return
 	}
+	target := s.Command()[1]
+	ref := s.Command()[2]
 
 	for _, serv := range myServices(c, target, hosts) {
+		hash, err := serv.resolve(ref)
+		if err != nil {
+			io.WriteString(s, http.StatusText(http.StatusNotAcceptable)+", "+err.Error())
+			s.Exit(http.StatusNotAcceptable)
+			return
+		}
 		serv.SetState(StateRollback, hash)
-		log.Infof("Machine %q, service %q set to %s", serv.Machine, serv.Service, StateRollback)
-		io.WriteString(s, http.StatusText(http.StatusOK))
+		log.Infof("Machine %q, service %q set to %s %s", serv.Machine, serv.Service, StateRollback, hash)
+		io.WriteString(s, hash)
 		s.Exit(0)
 		return
 	}
@@ -197,9 +263,115 @@ func PullService(c Config, s ssh.Session, hosts []string) {
 		return
 	}
 	target := s.Command()[1]
+	force := len(s.Command()) > 2 && s.Command()[2] == "--force"
 	for _, serv := range myServices(c, target, hosts) {
 		log.Infof("Machine %q, service %q set to pull now", serv.Machine, serv.Service)
-		serv.signalPullNow()
+		if err := serv.signalPullNow(force); err != nil {
+			log.Warningf("Machine %q, service %q, error pulling now: %s", serv.Machine, serv.Service, err)
+			io.WriteString(s, http.StatusText(http.StatusServiceUnavailable)+", "+err.Error())
+			s.Exit(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(s, http.StatusText(http.StatusOK))
+		s.Exit(0)
+		return
+	}
+	io.WriteString(s, http.StatusText(http.StatusNotFound))
+	s.Exit(http.StatusNotFound)
+}
+
+func AckService(c Config, s ssh.Session, hosts []string) {
+	if len(s.Command()) < 2 {
+		s.Exit(http.StatusNotAcceptable)
+		return
+	}
+	target := s.Command()[1]
+	for _, serv := range myServices(c, target, hosts) {
+		log.Infof("Machine %q, service %q local changes acknowledged", serv.Machine, serv.Service)
+		serv.Ack()
+		if err := serv.signalPullNow(false); err != nil {
+			log.Warningf("Machine %q, service %q, error pulling now: %s", serv.Machine, serv.Service, err)
+			io.WriteString(s, http.StatusText(http.StatusServiceUnavailable)+", "+err.Error())
+			s.Exit(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(s, http.StatusText(http.StatusOK))
+		s.Exit(0)
+		return
+	}
+	io.WriteString(s, http.StatusText(http.StatusNotFound))
+	s.Exit(http.StatusNotFound)
+}
+
+// stashID matches a, possibly abbreviated, stash id.
+var stashID = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
+func RestoreStashService(c Config, s ssh.Session, hosts []string) {
+	if len(s.Command()) < 3 {
+		s.Exit(http.StatusNotAcceptable)
+		return
+	}
+	target := s.Command()[1]
+	id := s.Command()[2]
+	if !stashID.MatchString(id) {
+		io.WriteString(s, http.StatusText(http.StatusNotAcceptable)+", not a valid hexadecimal stash id: "+id)
+		s.Exit(http.StatusNotAcceptable)
+		return
+	}
+	patch := len(s.Command()) > 3 && s.Command()[3] == "--patch"
+	for _, serv := range myServices(c, target, hosts) {
+		file, err := serv.RestoreStash(id, patch)
+		if err != nil {
+			log.Warningf("Machine %q, service %q, error restoring stash %s: %s", serv.Machine, serv.Service, id, err)
+			io.WriteString(s, http.StatusText(http.StatusInternalServerError)+", "+err.Error())
+			s.Exit(http.StatusInternalServerError)
+			return
+		}
+		if patch {
+			log.Infof("Machine %q, service %q stash %s written to %q", serv.Machine, serv.Service, id, file)
+			io.WriteString(s, file)
+			s.Exit(0)
+			return
+		}
+		log.Infof("Machine %q, service %q stash %s restored", serv.Machine, serv.Service, id)
+		io.WriteString(s, http.StatusText(http.StatusOK))
+		s.Exit(0)
+		return
+	}
+	io.WriteString(s, http.StatusText(http.StatusNotFound))
+	s.Exit(http.StatusNotFound)
+}
+
+func CheckoutService(c Config, s ssh.Session, hosts []string) {
+	if len(s.Command()) < 3 {
+		s.Exit(http.StatusNotAcceptable)
+		return
+	}
+	target := s.Command()[1]
+	ref := s.Command()[2]
+	if strings.HasPrefix(ref, "-") {
+		io.WriteString(s, http.StatusText(http.StatusNotAcceptable)+", not a valid ref: "+ref)
+		s.Exit(http.StatusNotAcceptable)
+		return
+	}
+	ttl := time.Duration(0)
+	if len(s.Command()) > 4 && s.Command()[3] == "--ttl" {
+		var err error
+		if ttl, err = time.ParseDuration(s.Command()[4]); err != nil || ttl <= 0 {
+			io.WriteString(s, http.StatusText(http.StatusNotAcceptable)+", not a valid ttl: "+s.Command()[4])
+			s.Exit(http.StatusNotAcceptable)
+			return
+		}
+	}
+	for _, serv := range myServices(c, target, hosts) {
+		serv.SetPin(ref, ttl)
+		log.Infof("Machine %q, service %q pinned to %q", serv.Machine, serv.Service, ref)
+		if err := serv.signalPullNow(false); err != nil {
+			log.Warningf("Machine %q, service %q, error pulling now: %s", serv.Machine, serv.Service, err)
+			io.WriteString(s, http.StatusText(http.StatusServiceUnavailable)+", "+err.Error())
+			s.Exit(http.StatusServiceUnavailable)
+			return
+		}
 		io.WriteString(s, http.StatusText(http.StatusOK))
 		s.Exit(0)
 		return
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/miekg/gitopper/ossvc"
+	"go.science.ru.nl/log"
+)
+
+// session is a fake ssh.Session, only what the router uses is implemented.
+type session struct {
+	ssh.Session
+	key     ssh.PublicKey
+	command []string
+	out     bytes.Buffer
+	status  int
+}
+
+func (s *session) PublicKey() ssh.PublicKey    { return s.key }
+func (s *session) User() string                { return "test" }
+func (s *session) Command() []string           { return s.command }
+func (s *session) Write(p []byte) (int, error) { return s.out.Write(p) }
+func (s *session) Exit(code int) error         { s.status = code; return nil }
+
+func TestRouterReadOnly(t *testing.T) {
+	log.Discard()
+	data, err := os.ReadFile("keys/miek_id_ed25519_gitopper.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := (&Service{Machine: "localhost", Service: "prometheus", Mount: t.TempDir(), mgr: &ossvc.Fake{}}).merge(Global{Service: &Service{}})
+	c := Config{Global: Global{Keys: []*Key{{Path: "keys/miek_id_ed25519_gitopper.pub", RO: true, PublicKey: pub}}}, Services: []*Service{s}}
+	router := newRouter(c, []string{"localhost"})
+
+	for _, command := range [][]string{
+		{"/do/freeze", "prometheus"},
+		{"/do/restore-stash", "prometheus", "deadbeef"},
+		{"/do/checkout", "prometheus", "feature", "--ttl", "2h"},
+	} {
+		sess := &session{key: pub, command: command}
+		router(sess)
+		if sess.status != http.StatusUnauthorized {
+			t.Errorf("expected %q to be refused for a read-only key, got status %d", command[0], sess.status)
+		}
+	}
+
+	if s.Pin() != nil {
+		t.Errorf("expected no pin from a read-only key, got %v", s.Pin())
+	}
+
+	sess := &session{key: pub, command: []string{"/list/history", "prometheus"}}
+	router(sess)
+	if sess.status != 0 {
+		t.Errorf("expected %q to be allowed for a read-only key, got status %d", "/list/history", sess.status)
+	}
+}
+
+func TestStashID(t *testing.T) {
+	for id, ok := range map[string]bool{
+		"deadbeef":   true,
+		"deadb":      true,
+		"dead":       true,
+		"dea":        false,
+		"deadbeefxx": false,
+		"-deadbeef":  false,
+		"DEADBEEF":   false,
+	} {
+		if stashID.MatchString(id) != ok {
+			t.Errorf("expected stash id %q to be valid %t, got %t", id, ok, !ok)
+		}
+	}
+}
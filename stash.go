@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path"
+
+	"github.com/miekg/gitopper/gitcmd"
+)
+
+// StashList returns the stashes with local changes in the git repo of s, newest first.
+func (s *Service) StashList() ([]gitcmd.Stash, error) {
+	return s.newGitCmd().Stashes()
+}
+
+// RestoreStash applies the stash with id to the git repo of s. If patch is true the repo is left alone and the
+// changes are written to a patch file for review instead, the name of that file is returned.
+func (s *Service) RestoreStash(id string, patch bool) (string, error) {
+	gc := s.newGitCmd()
+	if !patch {
+		if err := gc.RestoreStash(id); err != nil {
+			return "", err
+		}
+		s.Record("restored stash %s", id)
+		return "", nil
+	}
+
+	data, err := gc.StashPatch(id)
+	if err != nil {
+		return "", err
+	}
+	file := s.patchfile(id)
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return "", err
+	}
+	s.Record("wrote stash %s to %q", id, file)
+	return file, nil
+}
+
+// patchfile returns the file the stash with id is written to, it sits next to the statefile.
+func (s *Service) patchfile(id string) string {
+	return path.Join(s.Mount, ".gitopper", s.Service+"-"+id+".patch")
+}
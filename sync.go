@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+)
+
+// convFunc is called for each file that is synced, it may alter the name and the contents of the file.
+type convFunc func(name string, data []byte) (string, []byte, error)
+
+// syncTree makes dst a copy of the tree in src. Each file is written to a temporary file and then renamed, and only
+// when its contents or mode differ. Files in dst that don't exist (anymore) in src are removed. Any .git directory is
+// skipped. If conv is not nil each file is passed through it. The number of changed files is returned.
+func syncTree(src, dst string, conv convFunc) (int, error) {
+	changed := 0
+	seen := map[string]bool{}
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			seen[rel] = true
+			target := filepath.Join(dst, rel)
+			if _, err := os.Lstat(target); err == nil {
+				return nil
+			}
+			if err := os.MkdirAll(target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			chownAs(target, info)
+			changed++
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			seen[rel] = true
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(dst, rel)
+			if cur, err := os.Readlink(target); err == nil && cur == link {
+				return nil
+			}
+			os.Remove(target)
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			changed++
+			return nil
+		}
+
+		name, written, err := syncFile(p, filepath.Join(dst, filepath.Dir(rel)), conv)
+		if err != nil {
+			return err
+		}
+		seen[filepath.Join(filepath.Dir(rel), name)] = true
+		if written {
+			changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return changed, err
+	}
+
+	// Remove everything in dst we haven't seen, deepest paths first.
+	stale := []string{}
+	err = filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dst, p)
+		if err != nil {
+			return err
+		}
+		if !seen[rel] {
+			stale = append(stale, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return changed, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(stale)))
+	for _, p := range stale {
+		if err := os.RemoveAll(p); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// syncFile copies the file src into the directory dir, if conv is not nil the file is passed through it. The file
+// is only written when its contents or mode differ. The name of the file in dir is returned and true if it was written.
+func syncFile(src, dir string, conv convFunc) (string, bool, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", false, err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", false, err
+	}
+	name := filepath.Base(src)
+	if conv != nil {
+		if name, data, err = conv(name, data); err != nil {
+			return "", false, err
+		}
+	}
+	written, err := writeFile(filepath.Join(dir, name), data, info)
+	return name, written, err
+}
+
+// writeFile atomically writes data to name, with the mode and (if we are root) ownership from info. If name already
+// has the same contents and mode nothing is written and false is returned.
+func writeFile(name string, data []byte, info fs.FileInfo) (bool, error) {
+	if cur, err := os.Stat(name); err == nil && cur.Mode() == info.Mode() {
+		if old, err := os.ReadFile(name); err == nil && bytes.Equal(old, data) {
+			return false, nil
+		}
+	}
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return false, err
+	}
+	chownAs(tmp.Name(), info)
+	return true, os.Rename(tmp.Name(), name)
+}
+
+// chownAs sets the owner of name to the owner in info, this is only done when we are root.
+func chownAs(name string, info fs.FileInfo) {
+	if os.Geteuid() != 0 {
+		return
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		os.Lchown(name, int(st.Uid), int(st.Gid))
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/miekg/gitopper/ossvc"
+	"go.science.ru.nl/log"
+)
+
+// newUpstream creates a git repository in a temporary directory, with a single commit containing files.
+func newUpstream(t *testing.T, files map[string]string) string {
+	t.Helper()
+	upstream := t.TempDir()
+	gitRun(t, upstream, "init", "-q", "-b", "main")
+	commit(t, upstream, files)
+	return upstream
+}
+
+// commit writes files to the repo in dir and commits them.
+func commit(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		os.MkdirAll(path.Dir(path.Join(dir, name)), 0755)
+		if err := os.WriteFile(path.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "commit", "-q", "-m", "test")
+}
+
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.org"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %s: %s", args, err, out)
+	}
+}
+
+func TestTrackUpstream(t *testing.T) {
+	log.Discard()
+	upstream := newUpstream(t, map[string]string{"prometheus/etc/prometheus.yml": "v1"})
+	local := path.Join(t.TempDir(), "etc")
+	fake := &ossvc.Fake{}
+	s := &Service{
+		Upstream: upstream,
+		Service:  "prometheus",
+		Mount:    t.TempDir(),
+		Action:   "reload",
+		Dirs:     []Dir{{Local: local, Link: "prometheus/etc", Mode: ModeCopy}},
+		mgr:      fake,
+	}
+	s = s.merge(Global{Service: &Service{}})
+
+	gc := s.newGitCmd()
+	if err := gc.Checkout(); err != nil {
+		t.Fatalf("Failed to checkout repo %q: %s", s.Upstream, err)
+	}
+	if _, err := s.deploy(); err != nil {
+		t.Fatalf("Failed to deploy: %s", err)
+	}
+	hash := gc.Hash()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go s.trackUpstream(ctx, time.Hour)
+
+	commit(t, upstream, map[string]string{"prometheus/etc/prometheus.yml": "v2"})
+	for i := 0; i < 100; i++ { // wait for the tracking routine to start
+		if err := s.signalPullNow(false); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 100; i++ {
+		if len(fake.Calls()) == 2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	calls := fake.Calls()
+	if len(calls) != 2 || calls[0] != "reload" || calls[1] != "action reload prometheus" {
+		t.Fatalf("expected reload and action to be called, got %v", calls)
+	}
+	if buf, _ := os.ReadFile(path.Join(local, "prometheus.yml")); string(buf) != "v2" {
+		t.Errorf("expected local file to be updated to %q, got %q", "v2", buf)
+	}
+	if state, _ := s.State(); state != StateOK {
+		t.Errorf("expected state %s, got %s", StateOK, state)
+	}
+	if s.Hash() == hash {
+		t.Errorf("expected hash to be updated from %s", hash)
+	}
+}
+
+func TestActionCheckActive(t *testing.T) {
+	tests := []struct {
+		action      string
+		checkActive bool
+		err         bool
+	}{
+		{"restart", false, false},
+		{"restart", true, true},
+		{"stop", true, false},
+	}
+	for i, tc := range tests {
+		s := &Service{Service: "prometheus", Action: tc.action, CheckActive: tc.checkActive, mgr: &ossvc.Fake{Inactive: true}}
+		if err := s.action(); (err != nil) != tc.err {
+			t.Errorf("test %d, expected error %t, got %v", i, tc.err, err)
+		}
+	}
+}
+
+func TestUpdateWithoutLocal(t *testing.T) {
+	log.Discard()
+	upstream := newUpstream(t, map[string]string{"prometheus/etc/prometheus.yml": "v1"})
+	fake := &ossvc.Fake{}
+	s := &Service{
+		Upstream: upstream,
+		Service:  "prometheus",
+		Mount:    t.TempDir(),
+		Action:   "reload",
+		Dirs:     []Dir{{Link: "prometheus/etc"}},
+		mgr:      fake,
+	}
+	s = s.merge(Global{Service: &Service{}})
+	gc := s.newGitCmd()
+	if err := gc.Checkout(); err != nil {
+		t.Fatal(err)
+	}
+
+	commit(t, upstream, map[string]string{"prometheus/etc/prometheus.yml": "v2"})
+	s.update(gc, false)
+	calls := fake.Calls()
+	if len(calls) != 2 || calls[1] != "action reload prometheus" {
+		t.Errorf("expected action to be called for new commits, got %v", calls)
+	}
+}
+
+func TestSignalPullNow(t *testing.T) {
+	s := &Service{Service: "prometheus"}
+	s = s.merge(Global{Service: &Service{}})
+	if err := s.signalPullNow(false); err == nil {
+		t.Errorf("expected error for a service that isn't tracked")
+	}
+
+	// nothing is receiving, a pending pull must not block.
+	s.setTracked(true)
+	for i := 0; i < 3; i++ {
+		if err := s.signalPullNow(i == 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if force := <-s.pullNow; !force {
+		t.Errorf("expected the first, forced, pull to be pending")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a maintenance window, updates are only merged and acted upon when we are inside one. If End equals Start
+// the window is open the whole day.
+type Window struct {
+	Days     []string // Days of the week the window opens, i.e. "mon" or "monday", empty means every day.
+	Start    string   // Start of the window as "15:04".
+	End      string   // End of the window as "15:04", if End is before Start the window wraps past midnight.
+	Timezone string   // Timezone Start and End are given in, defaults to UTC.
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Valid returns an error if the window can't be parsed.
+func (w Window) Valid() error {
+	_, err := w.Open(time.Now())
+	return err
+}
+
+// Open returns true if t falls inside the window w.
+func (w Window) Open(t time.Time) (bool, error) {
+	loc := time.UTC
+	if w.Timezone != "" {
+		l, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return false, fmt.Errorf("window has invalid timezone %q: %s", w.Timezone, err)
+		}
+		loc = l
+	}
+	start, err := minutes(w.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := minutes(w.End)
+	if err != nil {
+		return false, err
+	}
+	days := map[time.Weekday]bool{}
+	for _, d := range w.Days {
+		d = strings.ToLower(d)
+		wd, ok := weekdays[d]
+		if !ok && len(d) > 3 { // full name, i.e. "monday"
+			wd, ok = weekdays[d[:3]]
+			ok = ok && strings.ToLower(wd.String()) == d
+		}
+		if !ok {
+			return false, fmt.Errorf("window has invalid day %q", d)
+		}
+		days[wd] = true
+	}
+	onDay := func(wd time.Weekday) bool { return len(days) == 0 || days[wd] }
+
+	t = t.In(loc)
+	now := t.Hour()*60 + t.Minute()
+	if start == end {
+		return onDay(t.Weekday()), nil
+	}
+	if start < end {
+		return onDay(t.Weekday()) && now >= start && now < end, nil
+	}
+	// The window wraps past midnight, the part after midnight belongs to the day before.
+	if now >= start && onDay(t.Weekday()) {
+		return true, nil
+	}
+	return now < end && onDay(t.AddDate(0, 0, -1).Weekday()), nil
+}
+
+// minutes parses "15:04" and returns the number of minutes since midnight.
+func minutes(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("window has invalid time %q: %s", s, err)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inWindow returns true when t is in any of the maintenance windows of s, or when s doesn't have any windows.
+func (s *Service) inWindow(t time.Time) bool {
+	if len(s.Window) == 0 {
+		return true
+	}
+	for _, w := range s.Window {
+		if ok, _ := w.Open(t); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// windowState returns "open" or "closed" depending on the current time and the windows of s. If s has no windows the
+// empty string is returned.
+func (s *Service) windowState() string {
+	if len(s.Window) == 0 {
+		return ""
+	}
+	if s.inWindow(time.Now()) {
+		return "open"
+	}
+	return "closed"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowOpen(t *testing.T) {
+	// 2022-11-19 is a Saturday.
+	sat := func(hm string) time.Time {
+		tm, _ := time.Parse("2006-01-02 15:04", "2022-11-19 "+hm)
+		return tm
+	}
+	for i, test := range []struct {
+		w    Window
+		t    time.Time
+		open bool
+	}{
+		{Window{Start: "02:00", End: "05:00"}, sat("03:00"), true},
+		{Window{Start: "02:00", End: "05:00"}, sat("05:00"), false},
+		{Window{Days: []string{"sat", "sun"}, Start: "02:00", End: "05:00"}, sat("03:00"), true},
+		{Window{Days: []string{"Saturday"}, Start: "02:00", End: "05:00"}, sat("03:00"), true},
+		{Window{Days: []string{"Monday"}, Start: "02:00", End: "05:00"}, sat("03:00"), false},
+		{Window{Days: []string{"fri"}, Start: "22:00", End: "06:00"}, sat("03:00"), true},  // wraps from friday
+		{Window{Days: []string{"sat"}, Start: "22:00", End: "06:00"}, sat("03:00"), false}, // wraps into sunday
+		{Window{Days: []string{"sat"}, Start: "22:00", End: "06:00"}, sat("23:00"), true},
+		{Window{Start: "02:00", End: "05:00", Timezone: "Europe/Amsterdam"}, sat("03:00"), true},  // 04:00 CET
+		{Window{Start: "02:00", End: "05:00", Timezone: "Europe/Amsterdam"}, sat("04:00"), false}, // 05:00 CET
+		{Window{Start: "00:00", End: "00:00"}, sat("03:00"), true},                                // all day
+		{Window{Days: []string{"sat"}, Start: "02:00", End: "02:00"}, sat("23:00"), true},
+		{Window{Days: []string{"sun"}, Start: "02:00", End: "02:00"}, sat("23:00"), false},
+	} {
+		open, err := test.w.Open(test.t)
+		if err != nil {
+			t.Fatalf("test %d, expected no error, got %s", i, err)
+		}
+		if open != test.open {
+			t.Errorf("test %d, expected window to be open %t, got %t", i, test.open, open)
+		}
+	}
+}
+
+func TestWindowInvalid(t *testing.T) {
+	for i, w := range []Window{
+		{Start: "2:00pm", End: "05:00"},
+		{Start: "02:00", End: "05:00", Days: []string{"someday"}},
+		{Start: "02:00", End: "05:00", Days: []string{"saturnday"}},
+		{Start: "02:00", End: "05:00", Days: []string{"monkey"}},
+		{Start: "02:00", End: "05:00", Days: []string{"mo"}},
+		{Start: "02:00", End: "05:00", Timezone: "Mars/Olympus_Mons"},
+	} {
+		if err := w.Valid(); err == nil {
+			t.Errorf("test %d, expected error, got none", i)
+		}
+	}
+}